@@ -4,924 +4,4931 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
+	"flag"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/doc/comment"
+	"go/importer"
 	"go/parser"
+	"go/printer"
+	"go/scanner"
 	"go/token"
+	"go/types"
 	"html/template"
+	"io"
+	"math"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// CodeSummary holds parsed information for a Go file.
+// CodeSummary holds parsed information for a Go file. HasCoverage reports whether the file
+// appears in the cover profile; the statement counts and TestCoverage are only set if it does.
 type CodeSummary struct {
 	Filename           string
 	Package            string
+	ImportPath         string
+	Module             string
+	Generated          bool
 	Types              []TypeDecl
 	Functions          []FuncDecl
 	Imports            []string
+	ImportLines        []ImportLine
 	Lines              int
+	SourceLines        int
 	CommentLines       int
+	BlankLines         int
+	MixedLines         int
 	LongFunctions      []FuncDecl
 	AvgComplexity      float64
+	AvgCognitive       float64
 	GodocCoverage      float64
+	PackageDoc         bool
+	DocumentedItems    int
+	DocumentableItems  int
+	Undocumented       []DocItem
+	DocFindings        []DocFinding
 	MaxFunctionDepth   int
 	MaintainabilityIdx float64
+	Halstead           HalsteadMetrics
 	Problems           []ProblemFunction
+	TypeErrors         int
+	HasCoverage        bool
+	Statements         int
+	CoveredStatements  int
+	TestCoverage       float64
+}
+
+// Position is the source span of a declaration or finding. Lines and columns are 1-based;
+// columns are byte offsets, as reported by go/token.
+type Position struct {
+	File      string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+}
+
+// positionOf returns the span of node.
+func positionOf(fset *token.FileSet, node ast.Node) Position {
+	start, end := fset.Position(node.Pos()), fset.Position(node.End())
+	return Position{File: start.Filename, Line: start.Line, Column: start.Column, EndLine: end.Line, EndColumn: end.Column}
+}
+
+// String formats the start of the span as file:line.
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// ImportLine is an import declaration of a file. Class is stdlib, internal or external;
+// Module, Version and Requirement (direct, indirect, go.sum only or missing) describe the
+// module that provides an external import.
+type ImportLine struct {
+	Path        string
+	Position    Position
+	Class       string
+	Module      string
+	Version     string
+	Requirement string
+}
+
+// ExternalModule is a module outside the analyzed one, the packages of it that are imported
+// and the analyzed packages that import them. A missing module is named by its import path.
+type ExternalModule struct {
+	Path        string
+	Version     string
+	Requirement string
+	Imports     []string
+	UsedBy      []string
+}
+
+// ExternalImportCount returns the number of the file's imports from other modules.
+func (s CodeSummary) ExternalImportCount() int {
+	count := 0
+	for _, imp := range s.ImportLines {
+		if imp.Class == importExternal {
+			count++
+		}
+	}
+	return count
+}
+
+// DocItem identifies an exported declaration without a doc comment. Kind is one of
+// package, type, func, method, const, var or field; methods and fields are named Type.Name.
+type DocItem struct {
+	Position
+	Kind string
+	Name string
+}
+
+// DocFinding is a quality problem in an existing doc comment; Position spans the comment.
+type DocFinding struct {
+	DocItem
+	Message string
 }
 
 // ProblemFunction struct holds a function name and its complexity if it needs immediate attention
 type ProblemFunction struct {
-	FunctionName string
-	Complexity   int64
+	FunctionName        string
+	Position            Position
+	Complexity          int64
+	CognitiveComplexity int64
+	CRAP                float64
+	Reason              string
+}
+
+// analysisOptions holds the thresholds applied while extracting declarations.
+type analysisOptions struct {
+	MaxCyclomatic   int
+	MaxCognitive    int
+	MaxCRAP         float64
+	Maintainability string
 }
 
 // TypeDecl represents a type declaration.
+// Fields holds the fields of a struct or the elements of an interface; for other kinds Expr
+// holds the right-hand side of the declaration.
+// Methods lists the methods declared on the type anywhere in its package, in source order, and
+// MethodComplexity sums their cyclomatic complexity.
+// ResolvedType, MethodSetSize and Implements are only filled in by the type-checked pass.
 type TypeDecl struct {
+	Name             string
+	Position         Position
+	Comment          string
+	Definition       string
+	Exported         bool
+	Kind             string
+	Alias            bool
+	TypeParams       []TypeField
+	Fields           []TypeField
+	Expr             string
+	ResolvedType     string
+	MethodSetSize    int
+	Implements       []string
+	Methods          []Method
+	MethodCount      int
+	MethodComplexity int
+}
+
+// Method is a method declared on a type, with the metrics of its FuncDecl.
+type Method struct {
 	Name       string
-	Comment    string
-	Definition string
+	Position   Position
+	Pointer    bool
 	Exported   bool
+	Complexity int
+	Cognitive  int
+}
+
+// Param describes a function parameter, result or type parameter. Name is empty for
+// unnamed parameters and Type is the element type of a variadic parameter.
+type Param struct {
+	Name     string
+	Type     string
+	Variadic bool
+}
+
+// TypeField describes a struct field, an interface element or a type parameter.
+type TypeField struct {
+	Name     string
+	Type     string
+	Tag      string
+	Comment  string
+	Embedded bool
+	Exported bool
+}
+
+// ComplexityBreakdown counts the decision points behind a cyclomatic complexity score.
+type ComplexityBreakdown struct {
+	If    int
+	For   int
+	Range int
+	Case  int
+	Comm  int
+	And   int
+	Or    int
+}
+
+// Total returns the number of decision points.
+func (b ComplexityBreakdown) Total() int {
+	return b.If + b.For + b.Range + b.Case + b.Comm + b.And + b.Or
 }
 
 // FuncDecl represents a function or method declaration.
+// ResolvedType is only filled in by the type-checked pass; Statements, CoveredStatements,
+// Coverage and CRAP only when the file appears in the cover profile.
 type FuncDecl struct {
-	Name       string
-	Comment    string
-	Signature  string
-	LineCount  int
-	Complexity int
-	MaxDepth   int
-	Exported   bool
+	Name              string
+	Position          Position
+	Comment           string
+	Signature         string
+	Receiver          string
+	ReceiverType      string
+	TypeParams        []Param
+	Params            []Param
+	Results           []Param
+	LineCount         int
+	SourceLines       int
+	CommentLines      int
+	BlankLines        int
+	MixedLines        int
+	Complexity        int
+	Breakdown         ComplexityBreakdown
+	Cognitive         int
+	MaxDepth          int
+	Halstead          HalsteadMetrics
+	Maintainability   float64
+	Exported          bool
+	ResolvedType      string
+	Statements        int
+	CoveredStatements int
+	Coverage          float64
+	CRAP              float64
 }
 
 // ProjectOverview holds aggregated project metrics.
 type ProjectOverview struct {
-	TotalFiles      int
-	TotalLines      int
-	TotalFunctions  int
-	TotalLongFuncs  int
-	AvgCommentRatio float64
-	AvgComplexity   float64
-	GodocCoverage   float64
-	TestCoverage    float64
-	PackageCount    int
-	DependencyCount int
-	ProjectHealth   float64
-	RiskyFiles      int
-	EffortHours     float64
-	PackageMetrics  map[string]PackageMetric
-}
-
-// PackageMetric holds metrics for a package.
+	TotalFiles         int
+	TotalLines         int
+	TotalSourceLines   int
+	TotalCommentLines  int
+	TotalBlankLines    int
+	GeneratedFiles     int
+	GeneratedLines     int
+	HandwrittenLines   int
+	IncludeGenerated   bool
+	TotalFunctions     int
+	TotalLongFuncs     int
+	AvgCommentRatio    float64
+	AvgComplexity      float64
+	AvgCognitive       float64
+	AvgMaintainability float64
+	GodocCoverage      float64
+	DocumentedItems    int
+	DocumentableItems  int
+	UndocumentedPkgs   []string
+	Undocumented       []DocItem
+	DocFindings        []DocFinding
+	TestCoverage       float64
+	CoverageStatus     string
+	CoverageNote       string
+	PackageCount       int
+	DependencyCount    int
+	StdlibImports      int
+	InternalImports    int
+	ExternalImports    int
+	ExternalModules    []ExternalModule
+	ProjectHealth      float64
+	RiskyFiles         int
+	EffortHours        float64
+	PackageMetrics     map[string]PackageMetric
+	CouplingNote       string
+	ImportGraph        map[string][]string
+	RuleViolations     []RuleViolation
+	TypeErrors         int
+	Implementations    []InterfaceImpl
+	Excluded           []ExcludedPath
+	TestInventory      []TestInventory
+	TestResults        []PackageTestResult
+	TestRuns           int
+	TestsPassed        int
+	TestsFailed        int
+	TestsSkipped       int
+	FlakyTests         []TestStat
+	SlowestTests       []TestStat
+	HighestRisk        []RiskFunction
+	RaceDetector       bool
+	DataRaces          []DataRace
+}
+
+// CoverageSummary describes the test coverage for the reports, e.g. "72.50%" or
+// "n/a (skipped: no go.mod in the analyzed directory)".
+func (o ProjectOverview) CoverageSummary() string {
+	switch o.CoverageStatus {
+	case coverageMeasured:
+		return fmt.Sprintf("%.2f%%", o.TestCoverage)
+	case coveragePartial:
+		return fmt.Sprintf("%.2f%% (partial: %s)", o.TestCoverage, o.CoverageNote)
+	}
+	return fmt.Sprintf("n/a (%s: %s)", o.CoverageStatus, o.CoverageNote)
+}
+
+// InterfaceImpl lists the analyzed types that implement an interface.
+type InterfaceImpl struct {
+	Interface    string
+	Implementers []string
+}
+
+// PackageMetric holds metrics for a package, keyed in ProjectOverview by its import path
+// relative to the module. Afferent (Ca) and Efferent (Ce) coupling count the analyzed packages
+// that import this one and that this one imports; Instability is Ce/(Ca+Ce), or 0 for an
+// isolated package.
+// Abstractness is the share of interfaces among the package's types, Distance is |A + I - 1|,
+// the distance from Martin's main sequence, and Zone names where the package sits.
+// CouplingCount is Ca + Ce, kept for consumers of the earlier JSON schema.
+//
+// Deprecated: CouplingCount is superseded by Afferent and Efferent.
 type PackageMetric struct {
-	FileCount     int
-	LineCount     int
-	ImportCount   int
-	CouplingCount int
+	Package           string
+	ImportPath        string
+	FileCount         int
+	LineCount         int
+	SourceLines       int
+	CommentLines      int
+	BlankLines        int
+	MixedLines        int
+	ImportCount       int
+	Afferent          int
+	Efferent          int
+	CouplingCount     int
+	Instability       float64
+	Statements        int
+	CoveredStatements int
+	Coverage          float64
+	TypeCount         int
+	InterfaceCount    int
+	Abstractness      float64
+	Distance          float64
+	Zone              string
+}
+
+// Zones of the abstractness/instability plane. A package far from the main sequence is either
+// concrete and depended upon (painful to change) or abstract and unused (useless).
+const (
+	zoneMainSequence = "main sequence"
+	zonePain         = "zone of pain"
+	zoneUselessness  = "zone of uselessness"
+	zoneIsolated     = "isolated"
+	zoneUnknown      = "n/a"
+)
+
+// mainSequenceTolerance is the distance up to which a package counts as on the main sequence.
+const mainSequenceTolerance = 0.3
+
+// sourceFile is a Go file selected for analysis and the import path of its package.
+type sourceFile struct {
+	Path       string
+	ImportPath string
+	Test       bool
 }
 
-// scanDirectory recursively finds all .go files (excluding test files).
-func scanDirectory(root string) ([]string, error) {
-	var goFiles []string
+// scanDirectory recursively finds all .go files (including _test.go files, which are
+// flagged as tests) accepted by filter, recording every excluded file or directory.
+func scanDirectory(root string, filter *pathFilter) ([]sourceFile, []ExcludedPath, error) {
+	modulePath := readModulePath(root)
+	var goFiles []sourceFile
+	var excluded []ExcludedPath
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") && !strings.HasSuffix(info.Name(), "_test.go") {
-			goFiles = append(goFiles, path)
+		if !info.IsDir() && !strings.HasSuffix(info.Name(), ".go") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if reason := filter.excludeReason(rel, info.IsDir()); reason != "" {
+			excluded = append(excluded, ExcludedPath{Path: rel, Reason: reason})
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			goFiles = append(goFiles, sourceFile{
+				Path:       path,
+				ImportPath: dirImportPath(root, modulePath, filepath.Dir(path)),
+				Test:       strings.HasSuffix(info.Name(), "_test.go"),
+			})
 		}
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("scanning directory: %w", err)
+		return nil, nil, fmt.Errorf("scanning directory: %w", err)
 	}
-	return goFiles, nil
+	return goFiles, excluded, nil
 }
 
-// parseFile parses a Go file and extracts detailed metrics.
-func parseFile(filename string) (CodeSummary, error) {
-	fset := token.NewFileSet()
-	problems := make([]ProblemFunction, 0)
-	f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
-	if err != nil {
-		return CodeSummary{}, fmt.Errorf("parsing file %s: %w", filename, err)
-	}
+// readModulePath returns the module path declared in root/go.mod, or "" if there is none.
+func readModulePath(root string) string {
+	return parseGoMod(root).Path
+}
 
-	summary := CodeSummary{Filename: filename, Package: f.Name.Name}
+// Import classes.
+const (
+	importStdlib   = "stdlib"
+	importInternal = "internal"
+	importExternal = "external"
+)
 
-	// Count lines and comments
-	if err := countLines(&summary, filename); err != nil {
-		return CodeSummary{}, err
-	}
+// How an external import's module is listed in go.mod.
+const (
+	requireDirect   = "direct"
+	requireIndirect = "indirect"
+	requireSumOnly  = "go.sum only"
+	requireMissing  = "missing"
+)
 
-	// Collect imports
-	summary.Imports = collectImports(f.Imports)
+// goModule holds the module path and requirements from root/go.mod and the module versions
+// listed in root/go.sum.
+type goModule struct {
+	Path     string
+	Requires []moduleRequirement
+	sums     map[string]string
+}
 
-	// Extract types and functions
-	metrics, err := extractDeclarations(f, fset, &problems)
+// moduleRequirement is a require directive. Version includes the target of a replace
+// directive, e.g. "v1.2.0 => ../fork".
+type moduleRequirement struct {
+	Path     string
+	Version  string
+	Indirect bool
+}
+
+// parseGoMod reads the module, require and replace directives of root/go.mod and the module
+// versions of root/go.sum. Missing files yield an empty goModule.
+func parseGoMod(root string) goModule {
+	mod := goModule{sums: make(map[string]string)}
+	content, err := os.ReadFile(filepath.Join(root, "go.mod"))
 	if err != nil {
-		return CodeSummary{}, err
+		return mod
+	}
+	replaces := make(map[string]string)
+	block := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		indirect := strings.Contains(line, "// indirect")
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.Trim(fields[i], `"`)
+		}
+		switch {
+		case fields[0] == "module" && len(fields) >= 2:
+			mod.Path = fields[1]
+		case fields[0] == "require" && len(fields) >= 3:
+			mod.Requires = append(mod.Requires, moduleRequirement{Path: fields[1], Version: fields[2], Indirect: indirect})
+		case fields[0] == "replace":
+			if arrow := strings.Index(line, "=>"); arrow >= 0 {
+				replaces[fields[1]] = strings.TrimSpace(line[arrow+2:])
+			}
+		}
+	}
+	for i, req := range mod.Requires {
+		if target, ok := replaces[req.Path]; ok {
+			mod.Requires[i].Version += " => " + target
+		}
 	}
 
-	summary.Types = metrics.types
-	summary.Functions = metrics.functions
-	summary.LongFunctions = metrics.longFunctions
-	summary.AvgComplexity = metrics.avgComplexity
-	summary.GodocCoverage = metrics.godocCoverage
-	summary.MaxFunctionDepth = metrics.maxFunctionDepth
-	summary.Problems = problems
-	summary.MaintainabilityIdx = calculateMaintainability(summary.Lines, summary.CommentLines, summary.AvgComplexity)
+	if sums, err := os.ReadFile(filepath.Join(root, "go.sum")); err == nil {
+		for _, line := range strings.Split(string(sums), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && !strings.HasSuffix(fields[1], "/go.mod") {
+				mod.sums[fields[0]] = fields[1]
+			}
+		}
+	}
+	return mod
+}
 
-	return summary, nil
+// classify sets the class of every import and, for imports from other modules, the module
+// that provides it: the longest required module path that prefixes the import path, or a
+// module listed in go.sum when go.mod does not require one.
+func (m goModule) classify(imports []ImportLine) {
+	for i := range imports {
+		imp := &imports[i]
+		switch {
+		case m.Path != "" && (imp.Path == m.Path || strings.HasPrefix(imp.Path, m.Path+"/")):
+			imp.Class = importInternal
+			continue
+		case isStdlib(imp.Path):
+			imp.Class = importStdlib
+			continue
+		}
+		imp.Class = importExternal
+		imp.Module, imp.Version, imp.Requirement = "", "", ""
+		for _, req := range m.Requires {
+			if (imp.Path == req.Path || strings.HasPrefix(imp.Path, req.Path+"/")) && len(req.Path) > len(imp.Module) {
+				imp.Module, imp.Version, imp.Requirement = req.Path, req.Version, requireDirect
+				if req.Indirect {
+					imp.Requirement = requireIndirect
+				}
+			}
+		}
+		if imp.Module != "" {
+			continue
+		}
+		for path, version := range m.sums {
+			if (imp.Path == path || strings.HasPrefix(imp.Path, path+"/")) && len(path) > len(imp.Module) {
+				imp.Module, imp.Version, imp.Requirement = path, version, requireSumOnly
+			}
+		}
+		if imp.Module == "" {
+			imp.Module, imp.Requirement = imp.Path, requireMissing
+		}
+	}
 }
 
-// countLines counts total and comment lines in a file.
-func countLines(summary *CodeSummary, filename string) error {
-	content, err := os.ReadFile(filename)
+// dirImportPath derives the import path of dir from the module path, falling back to the
+// slash-separated directory relative to root when the project has no go.mod.
+func dirImportPath(root, modulePath, dir string) string {
+	rel, err := filepath.Rel(root, dir)
 	if err != nil {
-		return fmt.Errorf("reading file %s: %w", filename, err)
+		rel = dir
 	}
-	lines := strings.Split(string(content), "\n")
-	summary.Lines = len(lines)
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*") {
-			summary.CommentLines++
-		}
+	rel = filepath.ToSlash(rel)
+	if modulePath == "" {
+		return rel
 	}
-	return nil
+	if rel == "." {
+		return modulePath
+	}
+	return modulePath + "/" + rel
 }
 
-// collectImports extracts import paths from AST.
-func collectImports(imports []*ast.ImportSpec) []string {
-	var result []string
-	for _, imp := range imports {
-		if imp.Path != nil {
-			impPath := strings.Trim(imp.Path.Value, `"`)
-			result = append(result, impPath)
+// readOnlyGoFlags returns GOFLAGS with any -mod flag replaced by -mod=readonly, or by
+// -mod=vendor when root has a vendor/modules.txt, so that no go command started on the module
+// at root updates its go.mod or go.sum, not even under GOFLAGS=-mod=mod.
+func readOnlyGoFlags(root string) string {
+	var flags []string
+	for _, flag := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if !strings.HasPrefix(flag, "-mod=") && !strings.HasPrefix(flag, "--mod=") {
+			flags = append(flags, flag)
 		}
 	}
-	return result
+	mode := "-mod=readonly"
+	if _, err := os.Stat(filepath.Join(root, "vendor", "modules.txt")); err == nil {
+		mode = "-mod=vendor"
+	}
+	return strings.Join(append(flags, mode), " ")
 }
 
-// declMetrics holds metrics extracted from declarations.
-type declMetrics struct {
-	types            []TypeDecl
-	functions        []FuncDecl
-	longFunctions    []FuncDecl
-	avgComplexity    float64
-	godocCoverage    float64
-	maxFunctionDepth int
+// goCommand returns a go command with args that runs in root and resolves modules read-only.
+func goCommand(root string, args ...string) *exec.Cmd {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "GOFLAGS="+readOnlyGoFlags(root))
+	return cmd
 }
 
-// extractDeclarations processes type and function declarations.
-func extractDeclarations(f *ast.File, fset *token.FileSet, problems *[]ProblemFunction) (declMetrics, error) {
-	var metrics declMetrics
-	var comments []*ast.CommentGroup
-	var exportedTypes, documentedTypes, exportedFuncs, documentedFuncs, totalComplexity int
+// goListPackage holds the subset of `go list -json` output used by loadPackages.
+type goListPackage struct {
+	Dir          string
+	ImportPath   string
+	GoFiles      []string
+	CgoFiles     []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	Error        *struct {
+		Err string
+	}
+}
 
-	// Collect comments
-	for _, cg := range f.Comments {
-		comments = append(comments, cg)
+// loadPackages resolves the module's package set with `go list`, so only files that are
+// compiled for the current build context and belong to the module rooted at root are
+// returned. testdata/, vendor/ and nested modules are excluded by the go command itself;
+// filter is then applied to the remaining files.
+func loadPackages(root string, filter *pathFilter) ([]sourceFile, []ExcludedPath, error) {
+	cmd := goCommand(root, "list", "-e", "-find", "-json", "./...")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing packages: %w: %s", err, strings.TrimSpace(stderr.String()))
 	}
 
-	getComment := func(pos token.Pos) string {
-		for _, cg := range comments {
-			if cg.End() < pos && cg.End() >= pos-2 {
-				return strings.TrimSpace(cg.Text())
-			}
-		}
-		return ""
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving %s: %w", root, err)
 	}
 
-	// Extract types
-	for _, decl := range f.Decls {
-		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
-			for _, spec := range genDecl.Specs {
-				typeSpec := spec.(*ast.TypeSpec)
-				def, err := formatTypeDef(typeSpec)
-				if err != nil {
-					continue
-				}
-				isExported := ast.IsExported(typeSpec.Name.Name)
-				if isExported {
-					exportedTypes++
-					if getComment(typeSpec.Pos()) != "" {
-						documentedTypes++
+	var goFiles []sourceFile
+	var excluded []ExcludedPath
+	seen := make(map[string]bool)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var pkg goListPackage
+		if err := dec.Decode(&pkg); err != nil {
+			return nil, nil, fmt.Errorf("decoding go list output: %w", err)
+		}
+		if pkg.Error != nil {
+			fmt.Fprintf(os.Stderr, "Warning: package %s: %s\n", pkg.ImportPath, pkg.Error.Err)
+		}
+		sources := append(pkg.GoFiles, pkg.CgoFiles...)
+		tests := append(pkg.TestGoFiles, pkg.XTestGoFiles...)
+		for i, name := range append(sources, tests...) {
+			path := filepath.Join(pkg.Dir, name)
+			if rel, err := filepath.Rel(absRoot, path); err == nil {
+				path = filepath.Join(root, rel)
+				if excludedPath, reason := filter.excludeReasonWithParents(filepath.ToSlash(rel)); reason != "" {
+					if !seen[excludedPath] {
+						seen[excludedPath] = true
+						excluded = append(excluded, ExcludedPath{Path: excludedPath, Reason: reason})
 					}
+					continue
 				}
-				metrics.types = append(metrics.types, TypeDecl{
-					Name:       typeSpec.Name.Name,
-					Comment:    getComment(typeSpec.Pos()),
-					Definition: def,
-					Exported:   isExported,
-				})
 			}
+			goFiles = append(goFiles, sourceFile{Path: path, ImportPath: pkg.ImportPath, Test: i >= len(sources)})
 		}
 	}
+	return goFiles, excluded, nil
+}
 
-	// Extract functions
-	for _, decl := range f.Decls {
-		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
-			lineCount := fset.Position(funcDecl.End()).Line - fset.Position(funcDecl.Pos()).Line + 1
-			complexity, maxDepth := calcFuncMetrics(funcDecl)
-			totalComplexity += complexity
-			isExported := ast.IsExported(funcDecl.Name.Name)
-			if isExported {
-				exportedFuncs++
-				if getComment(funcDecl.Pos()) != "" {
-					documentedFuncs++
-				}
-			}
-			if maxDepth > metrics.maxFunctionDepth {
-				metrics.maxFunctionDepth = maxDepth
-			}
+// ExcludedPath records a file or directory left out of the analysis and why.
+type ExcludedPath struct {
+	Path   string
+	Reason string
+}
 
-			sig := formatFuncSignature(funcDecl)
-			funcDeclData := FuncDecl{
-				Name:       funcDecl.Name.Name,
-				Comment:    getComment(funcDecl.Pos()),
-				Signature:  sig,
-				LineCount:  lineCount,
-				Complexity: complexity,
-				MaxDepth:   maxDepth,
-				Exported:   isExported,
-			}
-			metrics.functions = append(metrics.functions, funcDeclData)
-			if lineCount > 50 {
-				metrics.longFunctions = append(metrics.longFunctions, funcDeclData)
-			}
+// stringList is a repeatable string flag.
+type stringList []string
 
-			// Add the function to the list of problem functions if the complexity is  > 10 as it'd need immediate attention
-			if funcDeclData.Complexity > 10 {
-				problem := ProblemFunction{FunctionName: funcDeclData.Name, Complexity: int64(funcDeclData.Complexity)}
-				*problems = append(*problems, problem)
-			}
-		}
+// String implements flag.Value.
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value.
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// gitignoreRule is a single pattern from a .gitignore file.
+type gitignoreRule struct {
+	source   string // slash-separated path of the .gitignore, relative to the root
+	base     string // directory the pattern is relative to
+	line     string // the rule as written
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// pathFilter decides which paths under the root are analyzed. Vendor, testdata and hidden
+// directories are always skipped, then .gitignore rules and --exclude patterns apply, and
+// when --include patterns are given a file must match at least one of them.
+type pathFilter struct {
+	root       string
+	includes   []string
+	excludes   []string
+	gitignores map[string][]gitignoreRule
+}
+
+// newPathFilter creates a filter for root with the given glob patterns.
+func newPathFilter(root string, includes, excludes []string) *pathFilter {
+	return &pathFilter{
+		root:       root,
+		includes:   includes,
+		excludes:   excludes,
+		gitignores: make(map[string][]gitignoreRule),
 	}
+}
 
-	// Calculate metrics
-	if len(metrics.functions) > 0 {
-		metrics.avgComplexity = float64(totalComplexity) / float64(len(metrics.functions))
+// excludeReason returns why the slash-separated path rel (relative to the root) is
+// excluded, or "" if it should be analyzed. Ancestor directories are not consulted.
+func (pf *pathFilter) excludeReason(rel string, isDir bool) string {
+	if rel == "." {
+		return ""
+	}
+	name := path.Base(rel)
+	if isDir {
+		switch {
+		case name == "vendor":
+			return "vendor directory"
+		case name == "testdata":
+			return "testdata directory"
+		case strings.HasPrefix(name, "."):
+			return "hidden directory"
+		}
+	}
+	if rule, ok := pf.gitignored(rel, isDir); ok {
+		return fmt.Sprintf(".gitignore (%s: %s)", rule.source, rule.line)
+	}
+	for _, pattern := range pf.excludes {
+		if matchPattern(pattern, rel) {
+			return "--exclude " + pattern
+		}
 	}
-	totalExported := exportedTypes + exportedFuncs
-	if totalExported > 0 {
-		metrics.godocCoverage = float64(documentedTypes+documentedFuncs) / float64(totalExported) * 100
+	if !isDir && len(pf.includes) > 0 {
+		for _, pattern := range pf.includes {
+			if matchPattern(pattern, rel) {
+				return ""
+			}
+		}
+		return "not matched by --include"
 	}
+	return ""
+}
 
-	return metrics, nil
+// excludeReasonWithParents is like excludeReason but also checks every ancestor
+// directory of rel, for callers that do not walk the tree themselves.
+func (pf *pathFilter) excludeReasonWithParents(rel string) (string, string) {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if reason := pf.excludeReason(dir, true); reason != "" {
+			return dir, reason
+		}
+	}
+	return rel, pf.excludeReason(rel, false)
 }
 
-// formatTypeDef formats a type definition.
-func formatTypeDef(typeSpec *ast.TypeSpec) (string, error) {
-	var def strings.Builder
-	switch t := typeSpec.Type.(type) {
-	case *ast.StructType:
-		def.WriteString("struct {\n")
-		for _, field := range t.Fields.List {
-			for _, name := range field.Names {
-				def.WriteString(fmt.Sprintf("\t%s %s\n", name.Name, field.Type))
-			}
+// gitignored reports the last .gitignore rule matching rel, looking at the .gitignore files
+// of the root and of every directory above rel. A negated final match un-ignores the path.
+func (pf *pathFilter) gitignored(rel string, isDir bool) (gitignoreRule, bool) {
+	var dirs []string
+	dir := path.Dir(rel)
+	for {
+		dirs = append([]string{dir}, dirs...)
+		if dir == "." {
+			break
 		}
-		def.WriteString("}")
-	case *ast.InterfaceType:
-		def.WriteString("interface {\n")
-		for _, method := range t.Methods.List {
-			for _, name := range method.Names {
-				def.WriteString(fmt.Sprintf("\t%s %s\n", name.Name, method.Type))
+		dir = path.Dir(dir)
+	}
+
+	var match gitignoreRule
+	matched := false
+	for _, dir := range dirs {
+		for _, rule := range pf.loadGitignore(dir) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			target := rel
+			if rule.base != "." {
+				target = strings.TrimPrefix(rel, rule.base+"/")
+			}
+			ok := false
+			if rule.anchored {
+				ok = matchGlob(rule.pattern, target)
+			} else {
+				ok = matchGlob(rule.pattern, path.Base(target))
+			}
+			if ok {
+				match, matched = rule, !rule.negate
 			}
 		}
-		def.WriteString("}")
-	default:
-		return "", fmt.Errorf("unsupported type: %T", t)
 	}
-	return fmt.Sprintf("type %s %s", typeSpec.Name.Name, def.String()), nil
+	return match, matched
 }
 
-// calcFuncMetrics calculates cyclomatic complexity and max depth.
-func calcFuncMetrics(funcDecl *ast.FuncDecl) (complexity, maxDepth int) {
-	if funcDecl.Body == nil {
-		return 1, 0
+// loadGitignore parses (and caches) the .gitignore file in the slash-separated directory dir.
+func (pf *pathFilter) loadGitignore(dir string) []gitignoreRule {
+	if rules, ok := pf.gitignores[dir]; ok {
+		return rules
 	}
-	complexity = 1
-	currentDepth := 0
-	ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
-		switch n.(type) {
-		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.SelectStmt:
-			complexity++
-			currentDepth++
-			if currentDepth > maxDepth {
-				maxDepth = currentDepth
+	var rules []gitignoreRule
+	source := path.Join(dir, ".gitignore")
+	content, err := os.ReadFile(filepath.Join(pf.root, filepath.FromSlash(source)))
+	if err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimRight(line, " \r")
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
 			}
-		case *ast.BlockStmt:
-			if n != funcDecl.Body {
-				currentDepth++
-				if currentDepth > maxDepth {
-					maxDepth = currentDepth
-				}
+			rule := gitignoreRule{source: source, base: dir, line: line}
+			p := line
+			if strings.HasPrefix(p, "!") {
+				rule.negate = true
+				p = p[1:]
 			}
+			if strings.HasSuffix(p, "/") {
+				rule.dirOnly = true
+				p = strings.TrimSuffix(p, "/")
+			}
+			if strings.Contains(p, "/") {
+				rule.anchored = true
+				p = strings.TrimPrefix(p, "/")
+			}
+			rule.pattern = p
+			rules = append(rules, rule)
 		}
-		return true
-	})
-	return complexity, maxDepth
+	}
+	pf.gitignores[dir] = rules
+	return rules
 }
 
-// formatFuncSignature formats a function signature.
-func formatFuncSignature(funcDecl *ast.FuncDecl) string {
-	var sig strings.Builder
-	sig.WriteString("func ")
-	if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
-		recv := funcDecl.Recv.List[0]
-		if len(recv.Names) > 0 {
-			sig.WriteString(fmt.Sprintf("(%s %s) ", recv.Names[0].Name, recv.Type))
-		} else {
-			sig.WriteString(fmt.Sprintf("(%s) ", recv.Type))
-		}
+// matchPattern matches an --include/--exclude pattern against a slash-separated path
+// relative to the root. Patterns without a slash match the base name at any depth.
+func matchPattern(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if !strings.Contains(pattern, "/") {
+		return matchGlob(pattern, path.Base(rel))
 	}
-	sig.WriteString(funcDecl.Name.Name)
-	sig.WriteString("(")
-	for i, param := range funcDecl.Type.Params.List {
-		if i > 0 {
-			sig.WriteString(", ")
-		}
-		for j, name := range param.Names {
-			if j > 0 {
-				sig.WriteString(", ")
+	return matchGlob(pattern, rel)
+}
+
+// matchGlob matches a slash-separated path against a glob where each segment follows
+// path.Match and a "**" segment matches zero or more whole segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments is the recursive worker behind matchGlob.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
 			}
-			sig.WriteString(fmt.Sprintf("%s %s", name.Name, param.Type))
-		}
-	}
-	sig.WriteString(")")
-	if funcDecl.Type.Results != nil && len(funcDecl.Type.Results.List) > 0 {
-		sig.WriteString(" ")
-		if len(funcDecl.Type.Results.List) > 1 {
-			sig.WriteString("(")
+			return false
 		}
-		for i, result := range funcDecl.Type.Results.List {
-			if i > 0 {
-				sig.WriteString(", ")
-			}
-			sig.WriteString(fmt.Sprintf("%s", result.Type))
+		if len(name) == 0 {
+			return false
 		}
-		if len(funcDecl.Type.Results.List) > 1 {
-			sig.WriteString(")")
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
 		}
+		pattern, name = pattern[1:], name[1:]
 	}
-	return sig.String()
+	return len(name) == 0
 }
 
-// calculateMaintainability computes the maintainability index.
-func calculateMaintainability(lines, commentLines int, avgComplexity float64) float64 {
-	if lines == 0 {
-		return 100.0
-	}
-	commentRatio := float64(commentLines) / float64(lines)
-	idx := 100 - (float64(lines)/100 + avgComplexity*2 - commentRatio*50)
-	if idx < 0 {
-		return 0
+// parseFile parses a Go file and extracts detailed metrics.
+func parseFile(filename string, opts analysisOptions) (CodeSummary, error) {
+	fset := token.NewFileSet()
+	problems := make([]ProblemFunction, 0)
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return CodeSummary{}, fmt.Errorf("reading file %s: %w", filename, err)
 	}
-	if idx > 100 {
-		return 100
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return CodeSummary{}, fmt.Errorf("parsing file %s: %w", filename, err)
 	}
-	return idx
-}
 
-// generateMarkdown writes the Markdown summary.
-func generateMarkdown(summaries []CodeSummary, testCoverage float64, outputPath string) error {
-	var b strings.Builder
-	overview := computeProjectOverview(summaries)
+	summary := CodeSummary{Filename: filename, Package: f.Name.Name, Generated: ast.IsGenerated(f), PackageDoc: docText(f.Doc) != ""}
 
-	b.WriteString("# 📝 Go Code Summary\n\n")
-	b.WriteString("## 📊 Project Overview\n\n")
-	if overview.TotalFiles == 0 {
-		b.WriteString("No Go files found.\n\n")
-	} else {
-		b.WriteString(fmt.Sprintf("- 📂 Files Processed: %d\n", overview.TotalFiles))
-		b.WriteString(fmt.Sprintf("- 📏 Total Lines of Code: %d\n", overview.TotalLines))
-		b.WriteString(fmt.Sprintf("- 🛠️ Total Functions: %d\n", overview.TotalFunctions))
-		b.WriteString(fmt.Sprintf("- ⚠️ Long Functions (>50 lines): %d\n", overview.TotalLongFuncs))
-		b.WriteString(fmt.Sprintf("- 📜 Average Comment-to-Code Ratio: %.2f%%\n", overview.AvgCommentRatio))
-		b.WriteString(fmt.Sprintf("- 🧠 Average Function Complexity: %.2f\n", overview.AvgComplexity))
-		b.WriteString(fmt.Sprintf("- 📖 Godoc Coverage: %.2f%%\n", overview.GodocCoverage))
-		b.WriteString(fmt.Sprintf("- 🎯 Total Test Coverage: %.2f\n", testCoverage))
-		b.WriteString(fmt.Sprintf("- 📦 Packages: %d\n", overview.PackageCount))
-		b.WriteString(fmt.Sprintf("- 🔗 External Dependencies: %d\n", overview.DependencyCount))
-		b.WriteString(fmt.Sprintf("- 🏥 Project Health Score: %.2f/100\n", overview.ProjectHealth))
-		b.WriteString(fmt.Sprintf("- 🚨 Risky Files: %d\n", overview.RiskyFiles))
-		b.WriteString(fmt.Sprintf("- ⏰ Estimated Refactoring Effort: %.2f hours\n", overview.EffortHours))
-		b.WriteString("### ⚡ Immediate Attention Required\n\n")
-		foundProblems := true
-		for _, summary := range summaries {
-			if len(summary.Problems) != 0 {
-				for _, problem := range summary.Problems {
-					b.WriteString(fmt.Sprintf("\t- ❗ Function %s in file %s Need Refactoring as complexity is: %d ( > 10)\n",
-						problem.FunctionName, summary.Filename, problem.Complexity))
+	// Count lines and comments
+	kinds := countLines(&summary, src)
+
+	// Collect imports
+	summary.Imports, summary.ImportLines = collectImports(fset, f.Imports)
+
+	// Extract types and functions
+	tokens := scanTokens(src)
+	metrics, err := extractDeclarations(f, fset, tokens, kinds, opts, &problems)
+	if err != nil {
+		return CodeSummary{}, err
+	}
+
+	summary.Types = metrics.types
+	summary.Functions = metrics.functions
+	summary.LongFunctions = metrics.longFunctions
+	summary.AvgComplexity = metrics.avgComplexity
+	summary.AvgCognitive = metrics.avgCognitive
+	summary.GodocCoverage = metrics.godocCoverage
+	summary.DocumentedItems = metrics.documented
+	summary.DocumentableItems = metrics.documentable
+	summary.Undocumented = metrics.undocumented
+	summary.DocFindings = metrics.docFindings
+	summary.MaxFunctionDepth = metrics.maxFunctionDepth
+	summary.Problems = problems
+	summary.Halstead = computeHalstead(tokens, 0, len(src))
+	fileComplexity := float64(metrics.totalComplexity)
+	if opts.Maintainability == miLegacy {
+		// The legacy score was defined on the average function complexity.
+		fileComplexity = summary.AvgComplexity
+	}
+	summary.MaintainabilityIdx = maintainabilityIndex(opts.Maintainability, summary.Halstead.Volume, fileComplexity, summary.SourceLines, summary.CommentLines)
+
+	return summary, nil
+}
+
+// lineKind classifies a physical source line.
+type lineKind uint8
+
+const (
+	blankLine   lineKind = 0
+	codeLine    lineKind = 1 << 0
+	commentLine lineKind = 1 << 1
+	mixedLine            = codeLine | commentLine
+)
+
+// lineCounts holds the line classification totals of a file or function.
+type lineCounts struct {
+	Physical int
+	Source   int
+	Comment  int
+	Blank    int
+	Mixed    int
+}
+
+// classifyLines scans src and returns the kind of every physical line: lines holding any
+// token are code, lines covered by a comment (including the body of a block comment) are
+// comment, lines with both are mixed, and the rest are blank.
+func classifyLines(src []byte) []lineKind {
+	physical := bytes.Count(src, []byte("\n"))
+	if len(src) > 0 && src[len(src)-1] != '\n' {
+		physical++
+	}
+	kinds := make([]lineKind, physical)
+
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		kind := codeLine
+		if tok == token.COMMENT {
+			kind = commentLine
+		}
+		// Physical lines: generated files remap their positions with //line directives
+		start := file.PositionFor(pos, false).Line
+		end := start + strings.Count(lit, "\n")
+		for line := start; line <= end && line <= len(kinds); line++ {
+			kinds[line-1] |= kind
+		}
+	}
+	return kinds
+}
+
+// countLineKinds totals the kinds of the 1-based lines first through last.
+func countLineKinds(kinds []lineKind, first, last int) lineCounts {
+	var c lineCounts
+	for line := first; line <= last && line <= len(kinds); line++ {
+		if line < 1 {
+			continue
+		}
+		c.Physical++
+		switch kinds[line-1] {
+		case blankLine:
+			c.Blank++
+		case codeLine:
+			c.Source++
+		case commentLine:
+			c.Comment++
+		case mixedLine:
+			c.Source++
+			c.Comment++
+			c.Mixed++
+		}
+	}
+	return c
+}
+
+// countLines classifies the lines of a file's source.
+func countLines(summary *CodeSummary, src []byte) []lineKind {
+	kinds := classifyLines(src)
+	c := countLineKinds(kinds, 1, len(kinds))
+	summary.Lines = c.Physical
+	summary.SourceLines = c.Source
+	summary.CommentLines = c.Comment
+	summary.BlankLines = c.Blank
+	summary.MixedLines = c.Mixed
+	return kinds
+}
+
+// commentPercent returns comment lines as a percentage of source lines (SLOC).
+func commentPercent(commentLines, sourceLines int) float64 {
+	if sourceLines == 0 {
+		return 0
+	}
+	return float64(commentLines) / float64(sourceLines) * 100
+}
+
+// TestInventory summarizes the tests of a package and how they relate to its production code.
+type TestInventory struct {
+	Package         string
+	TestFiles       int
+	Tests           int
+	Benchmarks      int
+	Fuzzes          int
+	Examples        int
+	TableDriven     int
+	TestLines       int
+	ProductionLines int
+	TestToCodeRatio float64
+	Untested        []string
+}
+
+// testFileSummary holds what parseTestFile extracts from a single _test.go file.
+// Lines counts source lines (SLOC).
+type testFileSummary struct {
+	Filename    string
+	ImportPath  string
+	Lines       int
+	Tests       int
+	Benchmarks  int
+	Fuzzes      int
+	Examples    int
+	TableDriven int
+	Referenced  map[string]bool
+}
+
+// parseTestFile parses a _test.go file, classifies its test functions the way `go test`
+// does and collects every identifier it references.
+func parseTestFile(filename string) (testFileSummary, error) {
+	fset := token.NewFileSet()
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return testFileSummary{}, fmt.Errorf("reading file %s: %w", filename, err)
+	}
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return testFileSummary{}, fmt.Errorf("parsing test file %s: %w", filename, err)
+	}
+
+	var counted CodeSummary
+	countLines(&counted, src)
+	summary := testFileSummary{Filename: filename, Lines: counted.SourceLines, Referenced: make(map[string]bool)}
+
+	tables := tableVars(f.Decls)
+	for _, decl := range f.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Recv != nil {
+			continue
+		}
+		name := funcDecl.Name.Name
+		params := funcDecl.Type.Params.NumFields()
+		switch {
+		case isTestName(name, "Test") && params == 1 && !isTestMain(funcDecl):
+			summary.Tests++
+			if isTableDriven(funcDecl, tables) {
+				summary.TableDriven++
+			}
+		case isTestName(name, "Benchmark") && params == 1:
+			summary.Benchmarks++
+		case isTestName(name, "Fuzz") && params == 1:
+			summary.Fuzzes++
+		case isTestName(name, "Example") && params == 0 && funcDecl.Type.Results == nil:
+			summary.Examples++
+		}
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			summary.Referenced[ident.Name] = true
+		}
+		return true
+	})
+	return summary, nil
+}
+
+// isTestName reports whether name is prefix followed by nothing or by a character that is
+// not a lower-case letter, matching the rule `go test` uses to find test functions.
+func isTestName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+// isTestMain reports whether funcDecl is a TestMain(m *testing.M) entry point.
+func isTestMain(funcDecl *ast.FuncDecl) bool {
+	if funcDecl.Name.Name != "TestMain" {
+		return false
+	}
+	star, ok := funcDecl.Type.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "M"
+}
+
+// isTableLiteral reports whether expr is a slice, array or map literal with at least one
+// element, the usual shape of a test table.
+func isTableLiteral(expr ast.Expr) bool {
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || len(lit.Elts) == 0 {
+		return false
+	}
+	switch lit.Type.(type) {
+	case *ast.ArrayType, *ast.MapType:
+		return true
+	}
+	return false
+}
+
+// tableVars returns the names of package-level variables initialized with a table literal.
+func tableVars(decls []ast.Decl) map[string]bool {
+	tables := make(map[string]bool)
+	for _, decl := range decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for i, value := range valueSpec.Values {
+				if i < len(valueSpec.Names) && isTableLiteral(value) {
+					tables[valueSpec.Names[i].Name] = true
 				}
 			}
 		}
-		if !foundProblems {
-			b.WriteString("\t - Nothing immediate to fix\n\n")
+	}
+	return tables
+}
+
+// isTableDriven reports whether a test ranges over a table literal, either inline, through a
+// local variable or through one of the package-level tables.
+func isTableDriven(funcDecl *ast.FuncDecl, tables map[string]bool) bool {
+	if funcDecl.Body == nil {
+		return false
+	}
+	local := make(map[string]bool)
+	for name := range tables {
+		local[name] = true
+	}
+	ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+		switch stmt := n.(type) {
+		case *ast.AssignStmt:
+			for i, rhs := range stmt.Rhs {
+				if ident, ok := stmt.Lhs[min(i, len(stmt.Lhs)-1)].(*ast.Ident); ok && isTableLiteral(rhs) {
+					local[ident.Name] = true
+				}
+			}
+		case *ast.ValueSpec:
+			for i, value := range stmt.Values {
+				if i < len(stmt.Names) && isTableLiteral(value) {
+					local[stmt.Names[i].Name] = true
+				}
+			}
 		}
+		return true
+	})
 
-		b.WriteString("\n### 📦 Package Breakdown\n\n")
-		if len(overview.PackageMetrics) == 0 {
-			b.WriteString("No packages found.\n\n")
-		} else {
-			b.WriteString("| Package | Files | Lines | Imports | Coupling |\n")
-			b.WriteString("|---------|-------|-------|---------|----------|\n")
-			for pkg, metric := range overview.PackageMetrics {
-				b.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %d |\n", pkg, metric.FileCount, metric.LineCount, metric.ImportCount, metric.CouplingCount))
+	found := false
+	ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+		rangeStmt, ok := n.(*ast.RangeStmt)
+		if !ok || found {
+			return !found
+		}
+		if isTableLiteral(rangeStmt.X) {
+			found = true
+		} else if ident, ok := rangeStmt.X.(*ast.Ident); ok && local[ident.Name] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// buildTestInventory aggregates test files per package and relates them to the package's
+// production code: LOC ratio and exported functions no test file references by name.
+// Generated production files are not expected to be tested.
+func buildTestInventory(summaries []CodeSummary, tests []testFileSummary) []TestInventory {
+	inventory := make(map[string]*TestInventory)
+	referenced := make(map[string]map[string]bool)
+	get := func(pkg string) *TestInventory {
+		if inv, ok := inventory[pkg]; ok {
+			return inv
+		}
+		inv := &TestInventory{Package: pkg}
+		inventory[pkg] = inv
+		referenced[pkg] = make(map[string]bool)
+		return inv
+	}
+
+	for _, t := range tests {
+		inv := get(t.ImportPath)
+		inv.TestFiles++
+		inv.Tests += t.Tests
+		inv.Benchmarks += t.Benchmarks
+		inv.Fuzzes += t.Fuzzes
+		inv.Examples += t.Examples
+		inv.TableDriven += t.TableDriven
+		inv.TestLines += t.Lines
+		for name := range t.Referenced {
+			referenced[t.ImportPath][name] = true
+		}
+	}
+	for _, s := range summaries {
+		inv := get(s.ImportPath)
+		inv.ProductionLines += s.SourceLines
+		if s.Generated {
+			continue
+		}
+		for _, f := range s.Functions {
+			if !f.Exported || referenced[s.ImportPath][f.Name] {
+				continue
 			}
-			b.WriteString("\n")
+			name := f.Name
+			if f.Receiver != "" {
+				name = f.Receiver + "." + f.Name
+			}
+			inv.Untested = append(inv.Untested, name)
 		}
 	}
 
-	for _, summary := range summaries {
-		commentRatio := 0.0
-		if summary.Lines > 0 {
-			commentRatio = float64(summary.CommentLines) / float64(summary.Lines) * 100
+	result := make([]TestInventory, 0, len(inventory))
+	for _, inv := range inventory {
+		if inv.ProductionLines > 0 {
+			inv.TestToCodeRatio = float64(inv.TestLines) / float64(inv.ProductionLines)
 		}
-		maxFuncLines := 0
-		for _, f := range summary.Functions {
-			if f.LineCount > maxFuncLines {
-				maxFuncLines = f.LineCount
+		sort.Strings(inv.Untested)
+		result = append(result, *inv)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Package < result[j].Package
+	})
+	return result
+}
+
+// collectImports extracts import paths from AST, along with the position of each import.
+func collectImports(fset *token.FileSet, imports []*ast.ImportSpec) ([]string, []ImportLine) {
+	var result []string
+	var lines []ImportLine
+	for _, imp := range imports {
+		if imp.Path != nil {
+			impPath := strings.Trim(imp.Path.Value, `"`)
+			result = append(result, impPath)
+			lines = append(lines, ImportLine{Path: impPath, Position: positionOf(fset, imp)})
+		}
+	}
+	return result, lines
+}
+
+// declMetrics holds metrics extracted from declarations.
+type declMetrics struct {
+	types            []TypeDecl
+	functions        []FuncDecl
+	longFunctions    []FuncDecl
+	avgComplexity    float64
+	totalComplexity  int
+	avgCognitive     float64
+	godocCoverage    float64
+	documented       int
+	documentable     int
+	undocumented     []DocItem
+	docFindings      []DocFinding
+	maxFunctionDepth int
+}
+
+// docText returns the trimmed text of the first non-empty comment group.
+func docText(groups ...*ast.CommentGroup) string {
+	for _, cg := range groups {
+		if text := strings.TrimSpace(cg.Text()); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// markdownLinkPattern matches a Markdown-style [text](url) link, which godoc does not render.
+var markdownLinkPattern = regexp.MustCompile(`\[[^\[\]]+\]\([^)\s]+\)`)
+
+// isIdentRune reports whether r can continue a Go identifier.
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lintDoc checks a doc comment against the Go doc comment conventions: it starts with the
+// declared name (optionally after A, An or The), is not just a TODO, deprecation notices are
+// paragraphs starting with "Deprecated: ", and links and code blocks use the Go 1.19 syntax.
+func lintDoc(name, text string, checkName bool) []string {
+	var findings []string
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return nil
+	}
+
+	todoOnly := true
+	for _, line := range strings.Split(trimmed, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "TODO") && !strings.HasPrefix(line, "FIXME") && !strings.HasPrefix(line, "XXX") {
+			todoOnly = false
+			break
+		}
+	}
+	if todoOnly {
+		return []string{"doc comment is only a TODO"}
+	}
+
+	if checkName {
+		rest := trimmed
+		for _, article := range []string{"A ", "An ", "The "} {
+			if strings.HasPrefix(rest, article) && !strings.HasPrefix(rest, name+" ") {
+				rest = rest[len(article):]
+				break
 			}
 		}
-		b.WriteString(fmt.Sprintf("## 📂 %s (%s)\n\n", summary.Filename, summary.Package))
-		b.WriteString("📈 ***Metrics***:\n")
-		b.WriteString(fmt.Sprintf("- 📏 Lines of Code: %d\n", summary.Lines))
-		b.WriteString(fmt.Sprintf("- 🛠️ Number of Functions: %d\n", len(summary.Functions)))
-		b.WriteString(fmt.Sprintf("- 📏 Largest Function: %d lines\n", maxFuncLines))
-		b.WriteString(fmt.Sprintf("- ⚠️ Long Functions (>50 lines): %d\n", len(summary.LongFunctions)))
-		b.WriteString(fmt.Sprintf("- 📜 Comment-to-Code Ratio: %.2f%%\n", commentRatio))
-		b.WriteString(fmt.Sprintf("- 🧠 Average Function Complexity: %.2f\n", summary.AvgComplexity))
-		b.WriteString(fmt.Sprintf("- 📖 Godoc Coverage: %.2f%%\n", summary.GodocCoverage))
-		b.WriteString(fmt.Sprintf("- 🔲 Max Function Depth: %d\n", summary.MaxFunctionDepth))
-		b.WriteString(fmt.Sprintf("- 🛡️ Maintainability Index: %.2f\n", summary.MaintainabilityIdx))
-		b.WriteString(fmt.Sprintf("- 🔗 External Dependencies: %d\n\n", len(summary.Imports)))
+		after := strings.TrimPrefix(rest, name)
+		if len(after) == len(rest) || (after != "" && isIdentRune(rune(after[0]))) {
+			findings = append(findings, fmt.Sprintf("doc comment should start with %q", name))
+		}
+	}
 
-		if len(summary.Types) > 0 {
-			b.WriteString("### 🏗️ Types\n\n")
-			for _, t := range summary.Types {
-				if t.Comment != "" {
-					b.WriteString(fmt.Sprintf("%s\n\n", t.Comment))
+	// Only "Deprecated:" markers count; prose such as "Deprecated options are ignored" does not.
+	paragraphStart := true
+	for _, line := range strings.Split(trimmed, "\n") {
+		line = strings.TrimSpace(line)
+		marker := strings.HasPrefix(line, "Deprecated:") || strings.HasPrefix(line, "DEPRECATED:")
+		if marker && (!paragraphStart || !strings.HasPrefix(line, "Deprecated: ")) {
+			findings = append(findings, `deprecation notice should be a paragraph starting with "Deprecated: "`)
+			break
+		}
+		paragraphStart = line == ""
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			findings = append(findings, "code blocks should be indented, not fenced with ```")
+			break
+		}
+	}
+
+	// Brackets without a definition are plain text, such as an interval [0, 100], so only the
+	// link definitions are checked.
+	var parser comment.Parser
+	doc := parser.Parse(text)
+	for _, def := range doc.Links {
+		if u, err := url.Parse(def.URL); err != nil || !u.IsAbs() {
+			findings = append(findings, fmt.Sprintf("link [%s] has malformed URL %q", def.Text, def.URL))
+		}
+		if !def.Used {
+			findings = append(findings, fmt.Sprintf("link definition [%s] is never used", def.Text))
+		}
+	}
+	for _, match := range markdownLinkPattern.FindAllString(text, -1) {
+		findings = append(findings, fmt.Sprintf("Markdown link %s; use [text] with a link definition", match))
+	}
+	return findings
+}
+
+// extractDeclarations processes type and function declarations.
+func extractDeclarations(f *ast.File, fset *token.FileSet, tokens []halsteadToken, kinds []lineKind, opts analysisOptions, problems *[]ProblemFunction) (declMetrics, error) {
+	var metrics declMetrics
+	var totalComplexity, totalCognitive int
+
+	// Doc coverage: every exported type, func, const and var, every exported method of an
+	// exported type and every exported field of an exported struct should be documented.
+	checkDoc := func(kind, name string, node ast.Node, doc string) {
+		metrics.documentable++
+		if doc != "" {
+			metrics.documented++
+			return
+		}
+		metrics.undocumented = append(metrics.undocumented, DocItem{Position: positionOf(fset, node), Kind: kind, Name: name})
+	}
+	// Findings on fields and methods are named Type.Name, while their comments start with Name.
+	lint := func(kind, name string, doc *ast.CommentGroup, checkName bool) {
+		if doc == nil {
+			return
+		}
+		for _, message := range lintDoc(name[strings.LastIndex(name, ".")+1:], doc.Text(), checkName) {
+			item := DocItem{Position: positionOf(fset, doc), Kind: kind, Name: name}
+			metrics.docFindings = append(metrics.docFindings, DocFinding{DocItem: item, Message: message})
+		}
+	}
+	if f.Doc != nil {
+		// Package comments start with "Package name"; commands are free to name the program.
+		lint("package", "Package "+f.Name.Name, f.Doc, f.Name.Name != "main")
+	}
+
+	// Extract consts and vars
+	for _, decl := range f.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || (genDecl.Tok != token.CONST && genDecl.Tok != token.VAR) {
+			continue
+		}
+		// Findings are reported under the first exported name of the spec or group.
+		groupExported := ""
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			doc := docText(valueSpec.Doc, genDecl.Doc)
+			specExported := ""
+			for _, name := range valueSpec.Names {
+				if name.IsExported() {
+					if specExported == "" {
+						specExported = name.Name
+					}
+					checkDoc(genDecl.Tok.String(), name.Name, name, doc)
 				}
-				b.WriteString(fmt.Sprintf("```go\n%s\n```\n\n", t.Definition))
 			}
+			if specExported != "" {
+				if groupExported == "" {
+					groupExported = specExported
+				}
+				lint(genDecl.Tok.String(), specExported, valueSpec.Doc, len(valueSpec.Names) == 1)
+			}
+		}
+		// A group comment describes the whole block, so only a single declaration is name-checked.
+		if groupExported != "" {
+			single := !genDecl.Lparen.IsValid() && len(genDecl.Specs[0].(*ast.ValueSpec).Names) == 1
+			lint(genDecl.Tok.String(), groupExported, genDecl.Doc, single)
 		}
+	}
 
-		if len(summary.Functions) > 0 {
-			b.WriteString("### 🛠️ Functions\n\n")
-			for _, f := range summary.Functions {
-				if f.Comment != "" {
-					b.WriteString(fmt.Sprintf("%s\n\n", f.Comment))
+	// Extract types
+	for _, decl := range f.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				isExported := ast.IsExported(typeSpec.Name.Name)
+				// The doc of an unparenthesized declaration is attached to the GenDecl.
+				doc := typeSpec.Doc
+				if doc == nil && !genDecl.Lparen.IsValid() {
+					doc = genDecl.Doc
 				}
-				b.WriteString(fmt.Sprintf("```go\n%s\n```\n\n", f.Signature))
+				comment := docText(doc)
+				if isExported {
+					checkDoc("type", typeSpec.Name.Name, typeSpec, comment)
+					lint("type", typeSpec.Name.Name, doc, true)
+					if st, ok := typeSpec.Type.(*ast.StructType); ok {
+						for _, field := range st.Fields.List {
+							for _, name := range field.Names {
+								if name.IsExported() {
+									checkDoc("field", typeSpec.Name.Name+"."+name.Name, name, docText(field.Doc, field.Comment))
+									lint("field", typeSpec.Name.Name+"."+name.Name, field.Doc, false)
+								}
+							}
+						}
+					}
+				}
+				typeDecl := TypeDecl{
+					Name:       typeSpec.Name.Name,
+					Position:   positionOf(fset, typeSpec),
+					Comment:    comment,
+					Definition: formatTypeDef(fset, f.Comments, genDecl, typeSpec),
+					Exported:   isExported,
+					Kind:       typeKind(typeSpec.Type),
+					Alias:      typeSpec.Assign.IsValid(),
+					TypeParams: describeFields(fset, typeSpec.TypeParams, false),
+				}
+				switch t := typeSpec.Type.(type) {
+				case *ast.StructType:
+					typeDecl.Fields = describeFields(fset, t.Fields, false)
+				case *ast.InterfaceType:
+					typeDecl.Fields = describeFields(fset, t.Methods, true)
+				default:
+					typeDecl.Expr = nodeString(fset, typeSpec.Type)
+				}
+				metrics.types = append(metrics.types, typeDecl)
 			}
 		}
 	}
 
-	return os.WriteFile(outputPath, []byte(b.String()), 0644)
-}
+	// Extract functions
+	for _, decl := range f.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+			first, last := fset.PositionFor(funcDecl.Pos(), false).Line, fset.PositionFor(funcDecl.End(), false).Line
+			lineCount := last - first + 1
+			complexity, breakdown, maxDepth := calcFuncMetrics(funcDecl)
+			cognitive := cognitiveComplexity(funcDecl)
+			halstead := computeHalstead(tokens, fset.Position(funcDecl.Pos()).Offset, fset.Position(funcDecl.End()).Offset)
+			lines := countLineKinds(kinds, first, last)
+			totalComplexity += complexity
+			totalCognitive += cognitive
+			isExported := ast.IsExported(funcDecl.Name.Name)
+			receiver := receiverTypeName(funcDecl)
+			switch {
+			case isExported && receiver == "":
+				checkDoc("func", funcDecl.Name.Name, funcDecl, docText(funcDecl.Doc))
+				lint("func", funcDecl.Name.Name, funcDecl.Doc, true)
+			case isExported && ast.IsExported(receiver):
+				checkDoc("method", receiver+"."+funcDecl.Name.Name, funcDecl, docText(funcDecl.Doc))
+				lint("method", receiver+"."+funcDecl.Name.Name, funcDecl.Doc, true)
+			}
+			if maxDepth > metrics.maxFunctionDepth {
+				metrics.maxFunctionDepth = maxDepth
+			}
+
+			sig := formatFuncSignature(fset, funcDecl)
+			funcDeclData := FuncDecl{
+				Name:            funcDecl.Name.Name,
+				Position:        positionOf(fset, funcDecl),
+				Comment:         docText(funcDecl.Doc),
+				Signature:       sig,
+				Receiver:        receiver,
+				ReceiverType:    receiverType(fset, funcDecl),
+				TypeParams:      describeParams(fset, funcDecl.Type.TypeParams),
+				Params:          describeParams(fset, funcDecl.Type.Params),
+				Results:         describeParams(fset, funcDecl.Type.Results),
+				LineCount:       lineCount,
+				SourceLines:     lines.Source,
+				CommentLines:    lines.Comment,
+				BlankLines:      lines.Blank,
+				MixedLines:      lines.Mixed,
+				Complexity:      complexity,
+				Breakdown:       breakdown,
+				Cognitive:       cognitive,
+				MaxDepth:        maxDepth,
+				Halstead:        halstead,
+				Maintainability: maintainabilityIndex(opts.Maintainability, halstead.Volume, float64(complexity), lines.Source, lines.Comment),
+				Exported:        isExported,
+			}
+			metrics.functions = append(metrics.functions, funcDeclData)
+			if lineCount > 50 {
+				metrics.longFunctions = append(metrics.longFunctions, funcDeclData)
+			}
+
+			// Add the function to the list of problem functions if either complexity exceeds its threshold as it'd need immediate attention
+			var reasons []string
+			if funcDeclData.Complexity > opts.MaxCyclomatic {
+				reasons = append(reasons, fmt.Sprintf("cyclomatic complexity %d (> %d)", funcDeclData.Complexity, opts.MaxCyclomatic))
+			}
+			if funcDeclData.Cognitive > opts.MaxCognitive {
+				reasons = append(reasons, fmt.Sprintf("cognitive complexity %d (> %d)", funcDeclData.Cognitive, opts.MaxCognitive))
+			}
+			if len(reasons) > 0 {
+				problem := ProblemFunction{
+					FunctionName:        funcDeclData.Name,
+					Position:            funcDeclData.Position,
+					Complexity:          int64(funcDeclData.Complexity),
+					CognitiveComplexity: int64(funcDeclData.Cognitive),
+					Reason:              strings.Join(reasons, ", "),
+				}
+				*problems = append(*problems, problem)
+			}
+		}
+	}
+
+	// Calculate metrics
+	if len(metrics.functions) > 0 {
+		metrics.avgComplexity = float64(totalComplexity) / float64(len(metrics.functions))
+		metrics.totalComplexity = totalComplexity
+		metrics.avgCognitive = float64(totalCognitive) / float64(len(metrics.functions))
+	}
+	if metrics.documentable > 0 {
+		metrics.godocCoverage = float64(metrics.documented) / float64(metrics.documentable) * 100
+	}
+	sort.SliceStable(metrics.undocumented, func(i, j int) bool {
+		return metrics.undocumented[i].Line < metrics.undocumented[j].Line
+	})
+
+	return metrics, nil
+}
+
+// formatTypeDef renders a type spec exactly as gofmt would, including type parameters,
+// struct tags, embedded fields and the comments inside the declaration. The spec's doc
+// comment is left out since it is reported separately.
+func formatTypeDef(fset *token.FileSet, comments []*ast.CommentGroup, genDecl *ast.GenDecl, typeSpec *ast.TypeSpec) string {
+	spec := *typeSpec
+	spec.Doc = nil
+	decl := &ast.GenDecl{TokPos: typeSpec.Pos(), Tok: token.TYPE, Specs: []ast.Spec{&spec}}
+	if !genDecl.Lparen.IsValid() {
+		decl.TokPos = genDecl.TokPos
+	}
+	var buf bytes.Buffer
+	if err := gofmtConfig.Fprint(&buf, fset, &printer.CommentedNode{Node: decl, Comments: comments}); err != nil {
+		return fmt.Sprintf("type %s %s", typeSpec.Name.Name, nodeString(fset, typeSpec.Type))
+	}
+	return buf.String()
+}
+
+// gofmtConfig is the printer configuration gofmt uses.
+var gofmtConfig = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// nodeString renders an AST node the way gofmt would.
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := gofmtConfig.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// typeKind names the kind of type a spec declares, e.g. "struct", "map" or "func".
+// Specs whose right-hand side is another (possibly qualified or instantiated) type are "named".
+func typeKind(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	case *ast.FuncType:
+		return "func"
+	case *ast.MapType:
+		return "map"
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "slice"
+		}
+		return "array"
+	case *ast.ChanType:
+		return "chan"
+	case *ast.StarExpr:
+		return "pointer"
+	case *ast.ParenExpr:
+		return typeKind(t.X)
+	}
+	return "named"
+}
+
+// describeFields lists the fields of a struct, the elements of an interface or the
+// parameters of a type parameter list. Every name of a multi-name field gets its own entry;
+// embedded fields, embedded interfaces and union terms are named after their type.
+func describeFields(fset *token.FileSet, list *ast.FieldList, isInterface bool) []TypeField {
+	if list == nil {
+		return nil
+	}
+	var fields []TypeField
+	for _, field := range list.List {
+		typ := nodeString(fset, field.Type)
+		comment := ""
+		if field.Doc != nil {
+			comment = strings.TrimSpace(field.Doc.Text())
+		} else if field.Comment != nil {
+			comment = strings.TrimSpace(field.Comment.Text())
+		}
+		tag := ""
+		if field.Tag != nil {
+			tag = field.Tag.Value
+		}
+		if isInterface && len(field.Names) > 0 {
+			// Interface methods print as "func(...)"; drop the keyword to read as a method.
+			typ = strings.TrimPrefix(typ, "func")
+		}
+		if len(field.Names) == 0 {
+			name := typ
+			if !isInterface {
+				name = embeddedName(field.Type)
+			}
+			fields = append(fields, TypeField{Name: name, Type: typ, Tag: tag, Comment: comment, Embedded: true, Exported: ast.IsExported(name)})
+			continue
+		}
+		for _, name := range field.Names {
+			fields = append(fields, TypeField{Name: name.Name, Type: typ, Tag: tag, Comment: comment, Exported: name.IsExported()})
+		}
+	}
+	return fields
+}
+
+// embeddedName returns the field name of an embedded struct field: the type name without
+// pointer, package qualifier or type arguments.
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	}
+	return ""
+}
+
+// calcFuncMetrics calculates the McCabe cyclomatic complexity, its breakdown by construct
+// and the maximum nesting depth of control-flow statements. Complexity follows gocyclo:
+// 1 for the function plus one per if, for, range, non-default case or comm clause, && and
+// ||, including those inside function literals. An else if does not nest deeper than its if.
+func calcFuncMetrics(funcDecl *ast.FuncDecl) (complexity int, breakdown ComplexityBreakdown, maxDepth int) {
+	if funcDecl.Body == nil {
+		return 1, breakdown, 0
+	}
+	var stack []ast.Node
+	var nesting []bool
+	currentDepth := 0
+	ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+		if n == nil {
+			if nesting[len(nesting)-1] {
+				currentDepth--
+			}
+			stack, nesting = stack[:len(stack)-1], nesting[:len(nesting)-1]
+			return true
+		}
+
+		nests := false
+		switch n := n.(type) {
+		case *ast.IfStmt:
+			breakdown.If++
+			parent, ok := stack[len(stack)-1].(*ast.IfStmt)
+			nests = !ok || parent.Else != n
+		case *ast.ForStmt:
+			breakdown.For++
+			nests = true
+		case *ast.RangeStmt:
+			breakdown.Range++
+			nests = true
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			nests = true
+		case *ast.CaseClause:
+			if n.List != nil {
+				breakdown.Case++
+			}
+		case *ast.CommClause:
+			if n.Comm != nil {
+				breakdown.Comm++
+			}
+		case *ast.BinaryExpr:
+			switch n.Op {
+			case token.LAND:
+				breakdown.And++
+			case token.LOR:
+				breakdown.Or++
+			}
+		}
+		if nests {
+			currentDepth++
+			if currentDepth > maxDepth {
+				maxDepth = currentDepth
+			}
+		}
+		stack = append(stack, n)
+		nesting = append(nesting, nests)
+		return true
+	})
+	return 1 + breakdown.Total(), breakdown, maxDepth
+}
+
+// formatFuncSignature renders a function signature exactly as gofmt prints it, including
+// the receiver, type parameters, unnamed and variadic parameters and named results.
+func formatFuncSignature(fset *token.FileSet, funcDecl *ast.FuncDecl) string {
+	decl := *funcDecl
+	decl.Doc = nil
+	decl.Body = nil
+	return nodeString(fset, &decl)
+}
+
+// describeParams lists the entries of a parameter, result or type parameter list, one per
+// name. Unnamed entries get an empty Name; a variadic parameter reports its element type.
+func describeParams(fset *token.FileSet, list *ast.FieldList) []Param {
+	if list == nil {
+		return nil
+	}
+	var params []Param
+	for _, field := range list.List {
+		param := Param{Type: nodeString(fset, field.Type)}
+		if ellipsis, ok := field.Type.(*ast.Ellipsis); ok {
+			param.Type = nodeString(fset, ellipsis.Elt)
+			param.Variadic = true
+		}
+		if len(field.Names) == 0 {
+			params = append(params, param)
+			continue
+		}
+		for _, name := range field.Names {
+			param.Name = name.Name
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// cognitiveComplexity computes the SonarSource cognitive complexity of a function:
+// +1 for each if, else if, else, switch, select, for, goto, labeled break/continue, sequence
+// of like boolean operators and recursive call, plus a nesting penalty for if, switch,
+// select and loops equal to their nesting depth. Function literals add a nesting level.
+func cognitiveComplexity(funcDecl *ast.FuncDecl) int {
+	if funcDecl.Body == nil {
+		return 0
+	}
+	v := &cognitiveVisitor{
+		name:     funcDecl.Name.Name,
+		recv:     receiverName(funcDecl),
+		seenBool: make(map[*ast.BinaryExpr]bool),
+		total:    new(int),
+	}
+	ast.Walk(v, funcDecl.Body)
+	return *v.total
+}
+
+// receiverName returns the name bound to a method receiver, or "" if there is none.
+func receiverName(funcDecl *ast.FuncDecl) string {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 || len(funcDecl.Recv.List[0].Names) == 0 {
+		return ""
+	}
+	return funcDecl.Recv.List[0].Names[0].Name
+}
+
+// cognitiveVisitor walks a function body at a fixed nesting level.
+type cognitiveVisitor struct {
+	name     string
+	recv     string
+	nesting  int
+	seenBool map[*ast.BinaryExpr]bool
+	total    *int
+}
+
+// nested returns a visitor one nesting level deeper sharing the same total.
+func (v *cognitiveVisitor) nested() *cognitiveVisitor {
+	n := *v
+	n.nesting++
+	return &n
+}
+
+// walk visits node with v unless it is a nil interface, as optional statement and
+// expression fields are.
+func (v *cognitiveVisitor) walk(node ast.Node) {
+	if node != nil {
+		ast.Walk(v, node)
+	}
+}
+
+// Visit implements ast.Visitor.
+func (v *cognitiveVisitor) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.IfStmt:
+		v.visitIf(n, false)
+		return nil
+	case *ast.ForStmt:
+		*v.total += 1 + v.nesting
+		v.walk(n.Init)
+		v.walk(n.Cond)
+		v.walk(n.Post)
+		v.nested().walk(n.Body)
+		return nil
+	case *ast.RangeStmt:
+		*v.total += 1 + v.nesting
+		v.walk(n.X)
+		v.nested().walk(n.Body)
+		return nil
+	case *ast.SwitchStmt:
+		*v.total += 1 + v.nesting
+		v.walk(n.Init)
+		v.walk(n.Tag)
+		v.nested().walk(n.Body)
+		return nil
+	case *ast.TypeSwitchStmt:
+		*v.total += 1 + v.nesting
+		v.walk(n.Init)
+		v.walk(n.Assign)
+		v.nested().walk(n.Body)
+		return nil
+	case *ast.SelectStmt:
+		*v.total += 1 + v.nesting
+		v.nested().walk(n.Body)
+		return nil
+	case *ast.FuncLit:
+		v.nested().walk(n.Body)
+		return nil
+	case *ast.BranchStmt:
+		if n.Tok == token.GOTO || n.Label != nil {
+			*v.total++
+		}
+	case *ast.BinaryExpr:
+		if (n.Op == token.LAND || n.Op == token.LOR) && !v.seenBool[n] {
+			ops := v.boolOperators(n)
+			for i, op := range ops {
+				if i == 0 || op != ops[i-1] {
+					*v.total++
+				}
+			}
+		}
+	case *ast.CallExpr:
+		if v.isRecursive(n) {
+			*v.total++
+		}
+	}
+	return v
+}
+
+// visitIf scores an if statement and its else chain. Only the leading if pays the nesting
+// penalty; else if and else add one each.
+func (v *cognitiveVisitor) visitIf(n *ast.IfStmt, elseIf bool) {
+	if elseIf {
+		*v.total++
+	} else {
+		*v.total += 1 + v.nesting
+	}
+	v.walk(n.Init)
+	v.walk(n.Cond)
+	v.nested().walk(n.Body)
+	switch e := n.Else.(type) {
+	case *ast.IfStmt:
+		v.visitIf(e, true)
+	case *ast.BlockStmt:
+		*v.total++
+		v.nested().walk(e)
+	}
+}
+
+// boolOperators flattens a chain of && and || operators in source order, marking every
+// binary expression in the chain as seen. Parentheses start a new chain.
+func (v *cognitiveVisitor) boolOperators(n *ast.BinaryExpr) []token.Token {
+	v.seenBool[n] = true
+	var ops []token.Token
+	if left, ok := n.X.(*ast.BinaryExpr); ok && (left.Op == token.LAND || left.Op == token.LOR) {
+		ops = append(ops, v.boolOperators(left)...)
+	}
+	ops = append(ops, n.Op)
+	if right, ok := n.Y.(*ast.BinaryExpr); ok && (right.Op == token.LAND || right.Op == token.LOR) {
+		ops = append(ops, v.boolOperators(right)...)
+	}
+	return ops
+}
+
+// isRecursive reports whether call invokes the function being analyzed, either directly
+// or, for methods, through the receiver.
+func (v *cognitiveVisitor) isRecursive(call *ast.CallExpr) bool {
+	switch fn := call.Fun.(type) {
+	case *ast.Ident:
+		return v.recv == "" && fn.Name == v.name
+	case *ast.SelectorExpr:
+		x, ok := fn.X.(*ast.Ident)
+		return ok && v.recv != "" && x.Name == v.recv && fn.Sel.Name == v.name
+	}
+	return false
+}
+
+// receiverType renders the receiver type of a method, e.g. "*Stack[T]", or "" for functions.
+func receiverType(fset *token.FileSet, funcDecl *ast.FuncDecl) string {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return ""
+	}
+	return nodeString(fset, funcDecl.Recv.List[0].Type)
+}
+
+// receiverTypeName returns the base type name of a method receiver, or "" for functions.
+func receiverTypeName(funcDecl *ast.FuncDecl) string {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return ""
+	}
+	expr := funcDecl.Recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// typeChecker type-checks the analyzed packages from source. Imports of other analyzed
+// packages are resolved recursively; everything else goes through the standard importers.
+// keys maps each file to the package it is checked with.
+type typeChecker struct {
+	fset     *token.FileSet
+	files    map[string][]*ast.File
+	keys     map[string]string
+	pkgs     map[string]*types.Package
+	checking map[string]bool
+	errors   map[string]int
+	gc       types.Importer
+	source   types.ImporterFrom
+}
+
+// newTypeChecker parses the files of every summary into a shared file set, grouped by import
+// path. Files excluded by build constraints for the current platform are skipped. A directory
+// whose files declare several packages, e.g. a "//go:build ignore" package main next to a
+// library, is split by package clause: the clause most files share is checked under the import
+// path, every other clause as a package of its own that nothing can import.
+func newTypeChecker(summaries []CodeSummary) *typeChecker {
+	fset := token.NewFileSet()
+	tc := &typeChecker{
+		fset:     fset,
+		files:    make(map[string][]*ast.File),
+		keys:     make(map[string]string),
+		pkgs:     make(map[string]*types.Package),
+		checking: make(map[string]bool),
+		errors:   make(map[string]int),
+		gc:       importer.Default(),
+		source:   importer.ForCompiler(fset, "source", nil).(types.ImporterFrom),
+	}
+	clauses := make(map[string]map[string][]*ast.File)
+	for _, s := range summaries {
+		if match, err := build.Default.MatchFile(filepath.Dir(s.Filename), filepath.Base(s.Filename)); err != nil || !match {
+			continue
+		}
+		f, err := parser.ParseFile(fset, s.Filename, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		if clauses[s.ImportPath] == nil {
+			clauses[s.ImportPath] = make(map[string][]*ast.File)
+		}
+		clauses[s.ImportPath][f.Name.Name] = append(clauses[s.ImportPath][f.Name.Name], f)
+	}
+	for path, byName := range clauses {
+		primary := ""
+		for name, files := range byName {
+			if primary == "" || len(files) > len(byName[primary]) || (len(files) == len(byName[primary]) && name < primary) {
+				primary = name
+			}
+		}
+		for name, files := range byName {
+			key := path
+			if name != primary {
+				key = path + " [" + name + "]"
+			}
+			tc.files[key] = files
+			for _, f := range files {
+				tc.keys[fset.Position(f.Package).Filename] = key
+			}
+		}
+	}
+	return tc
+}
+
+// Import implements types.Importer.
+func (tc *typeChecker) Import(path string) (*types.Package, error) {
+	return tc.ImportFrom(path, ".", 0)
+}
+
+// ImportFrom implements types.ImporterFrom.
+func (tc *typeChecker) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if _, ok := tc.files[path]; ok {
+		return tc.check(path)
+	}
+	if pkg, err := tc.gc.Import(path); err == nil {
+		return pkg, nil
+	}
+	return tc.source.ImportFrom(path, dir, mode)
+}
+
+// check type-checks the analyzed package with the given import path, tolerating errors so
+// that partially broken packages still yield as much type information as possible.
+func (tc *typeChecker) check(path string) (*types.Package, error) {
+	if pkg, ok := tc.pkgs[path]; ok {
+		return pkg, nil
+	}
+	if tc.checking[path] {
+		return nil, fmt.Errorf("import cycle through %s", path)
+	}
+	tc.checking[path] = true
+	defer delete(tc.checking, path)
+
+	conf := types.Config{
+		Importer: tc,
+		Error: func(err error) {
+			if terr, ok := err.(types.Error); ok {
+				tc.errors[terr.Fset.Position(terr.Pos).Filename]++
+			}
+		},
+	}
+	pkg, _ := conf.Check(path, tc.fset, tc.files[path], nil)
+	tc.pkgs[path] = pkg
+	return pkg, nil
+}
+
+// groupMethods attaches every method to the TypeDecl of its receiver. Methods may be declared
+// in any file of the receiver's package.
+func groupMethods(summaries []CodeSummary) {
+	methods := make(map[string][]Method)
+	for _, s := range summaries {
+		for _, f := range s.Functions {
+			if f.Receiver == "" {
+				continue
+			}
+			key := s.ImportPath + "." + f.Receiver
+			methods[key] = append(methods[key], Method{
+				Name:       f.Name,
+				Position:   f.Position,
+				Pointer:    strings.HasPrefix(f.ReceiverType, "*"),
+				Exported:   f.Exported,
+				Complexity: f.Complexity,
+				Cognitive:  f.Cognitive,
+			})
+		}
+	}
+	for i := range summaries {
+		for j := range summaries[i].Types {
+			t := &summaries[i].Types[j]
+			t.Methods = methods[summaries[i].ImportPath+"."+t.Name]
+			t.MethodCount = len(t.Methods)
+			t.MethodComplexity = 0
+			for _, m := range t.Methods {
+				t.MethodComplexity += m.Complexity
+			}
+		}
+	}
+}
+
+// analyzeTypes runs the type-checked pass over all summaries. It attaches resolved types to
+// functions and types, the size of each type's method set, and the interfaces each
+// non-interface type implements, searched among the analyzed packages, the packages they
+// import and the predeclared error interface.
+func analyzeTypes(summaries []CodeSummary) {
+	tc := newTypeChecker(summaries)
+	paths := make([]string, 0, len(tc.files))
+	for path := range tc.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		tc.check(path)
+	}
+
+	var wellKnown []*types.Package
+	for _, path := range wellKnownInterfacePackages {
+		if pkg, err := tc.ImportFrom(path, ".", 0); err == nil {
+			wellKnown = append(wellKnown, pkg)
+		}
+	}
+	ifaces := collectInterfaces(tc.pkgs, wellKnown)
+	for i := range summaries {
+		s := &summaries[i]
+		s.TypeErrors = tc.errors[s.Filename]
+		pkg := tc.pkgs[tc.keys[s.Filename]]
+		if pkg == nil {
+			continue
+		}
+		qualifier := types.RelativeTo(pkg)
+		for j := range s.Functions {
+			if fn := lookupFunc(pkg, s.Functions[j].Receiver, s.Functions[j].Name); fn != nil {
+				s.Functions[j].ResolvedType = types.ObjectString(fn, qualifier)
+			}
+		}
+		for j := range s.Types {
+			t := &s.Types[j]
+			obj, ok := pkg.Scope().Lookup(t.Name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			t.ResolvedType = types.TypeString(obj.Type().Underlying(), qualifier)
+			t.MethodSetSize = types.NewMethodSet(types.NewPointer(obj.Type())).Len()
+			t.Implements = implementedInterfaces(obj, ifaces)
+		}
+	}
+}
+
+// lookupFunc finds the types object for a top-level function or a method of recv.
+func lookupFunc(pkg *types.Package, recv, name string) *types.Func {
+	if recv == "" {
+		fn, _ := pkg.Scope().Lookup(name).(*types.Func)
+		return fn
+	}
+	obj, ok := pkg.Scope().Lookup(recv).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < named.NumMethods(); i++ {
+		if m := named.Method(i); m.Name() == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// wellKnownInterfacePackages are the standard library packages whose interfaces are always
+// checked, whether or not the analyzed code imports them.
+var wellKnownInterfacePackages = []string{"encoding", "encoding/json", "flag", "fmt", "io", "net/http", "sort"}
+
+// collectInterfaces gathers the non-empty, non-generic interfaces declared in the analyzed
+// packages, their direct imports and the well-known standard library packages, keyed by their
+// fully qualified name.
+func collectInterfaces(pkgs map[string]*types.Package, wellKnown []*types.Package) map[string]*types.Interface {
+	ifaces := map[string]*types.Interface{
+		"error": types.Universe.Lookup("error").Type().Underlying().(*types.Interface),
+	}
+	addScope := func(pkg *types.Package, exportedOnly bool) {
+		for _, name := range pkg.Scope().Names() {
+			obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+			if !ok || obj.IsAlias() || (exportedOnly && !obj.Exported()) {
+				continue
+			}
+			named, ok := obj.Type().(*types.Named)
+			if !ok || named.TypeParams().Len() > 0 {
+				continue
+			}
+			iface, ok := named.Underlying().(*types.Interface)
+			if !ok || iface.Empty() || !iface.IsMethodSet() {
+				continue
+			}
+			ifaces[types.TypeString(named, nil)] = iface
+		}
+	}
+	for _, pkg := range pkgs {
+		if pkg == nil {
+			continue
+		}
+		addScope(pkg, false)
+		for _, imp := range pkg.Imports() {
+			addScope(imp, true)
+		}
+	}
+	for _, pkg := range wellKnown {
+		addScope(pkg, true)
+	}
+	return ifaces
+}
+
+// implementedInterfaces returns the sorted names of the interfaces that obj or a pointer to
+// it implements. Interfaces, aliases and generic types are skipped.
+func implementedInterfaces(obj *types.TypeName, ifaces map[string]*types.Interface) []string {
+	named, ok := obj.Type().(*types.Named)
+	if !ok || obj.IsAlias() || named.TypeParams().Len() > 0 || types.IsInterface(named) {
+		return nil
+	}
+	var result []string
+	for name, iface := range ifaces {
+		if types.Implements(named, iface) || types.Implements(types.NewPointer(named), iface) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// HalsteadMetrics holds Halstead's software science measures for a token stream.
+type HalsteadMetrics struct {
+	DistinctOperators int
+	DistinctOperands  int
+	TotalOperators    int
+	TotalOperands     int
+	Vocabulary        int
+	Length            int
+	Volume            float64
+	Difficulty        float64
+	Effort            float64
+}
+
+// halsteadToken is a scanned token and its byte offset in the file.
+type halsteadToken struct {
+	offset int
+	tok    token.Token
+	lit    string
+}
+
+// scanTokens returns the Halstead-relevant tokens of src. Automatically inserted
+// semicolons and closing delimiters are dropped, so a bracket pair counts as one operator.
+func scanTokens(src []byte) []halsteadToken {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, src, nil, 0)
+	var tokens []halsteadToken
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch {
+		case tok == token.SEMICOLON && lit == "\n":
+			continue
+		case tok == token.RPAREN || tok == token.RBRACK || tok == token.RBRACE:
+			continue
+		}
+		tokens = append(tokens, halsteadToken{offset: file.Offset(pos), tok: tok, lit: lit})
+	}
+	return tokens
+}
+
+// computeHalstead computes Halstead metrics over the tokens whose offsets fall in
+// [start, end). Identifiers and literals are operands; keywords and operators are operators.
+func computeHalstead(tokens []halsteadToken, start, end int) HalsteadMetrics {
+	var h HalsteadMetrics
+	operators := make(map[token.Token]bool)
+	operands := make(map[string]bool)
+	for _, t := range tokens {
+		if t.offset < start || t.offset >= end {
+			continue
+		}
+		if t.tok == token.IDENT || t.tok.IsLiteral() {
+			h.TotalOperands++
+			operands[t.lit] = true
+		} else {
+			h.TotalOperators++
+			operators[t.tok] = true
+		}
+	}
+	h.DistinctOperators = len(operators)
+	h.DistinctOperands = len(operands)
+	h.Vocabulary = h.DistinctOperators + h.DistinctOperands
+	h.Length = h.TotalOperators + h.TotalOperands
+	if h.Vocabulary > 0 {
+		h.Volume = float64(h.Length) * math.Log2(float64(h.Vocabulary))
+	}
+	if h.DistinctOperands > 0 {
+		h.Difficulty = float64(h.DistinctOperators) / 2 * float64(h.TotalOperands) / float64(h.DistinctOperands)
+	}
+	h.Effort = h.Difficulty * h.Volume
+	return h
+}
+
+// Maintainability index variants selectable with -mi.
+const (
+	miVisualStudio = "vs"
+	miSEI          = "sei"
+	miLegacy       = "legacy"
+)
+
+// maintainabilityIndex computes the maintainability index from Halstead volume, cyclomatic
+// complexity and lines of code, normalized to 0–100:
+//
+//	vs:  (171 - 5.2 ln V - 0.23 G - 16.2 ln LOC) * 100 / 171
+//	sei: as vs, adding 50 sin(sqrt(2.4 C)) before normalizing, with C the comment
+//	     percentage in radians (as radon does)
+//
+// The legacy variant is the original ad-hoc score and ignores the Halstead volume.
+func maintainabilityIndex(variant string, volume, complexity float64, lines, commentLines int) float64 {
+	if variant == miLegacy {
+		return calculateMaintainability(lines, commentLines, complexity)
+	}
+	if volume <= 0 || lines <= 0 {
+		return 100
+	}
+	mi := 171 - 5.2*math.Log(volume) - 0.23*complexity - 16.2*math.Log(float64(lines))
+	if variant == miSEI {
+		commentPercent := float64(commentLines) / float64(lines) * 100
+		mi += 50 * math.Sin(math.Sqrt(2.4*commentPercent*math.Pi/180))
+	}
+	return math.Max(0, math.Min(100, mi*100/171))
+}
+
+// calculateMaintainability computes the legacy maintainability index.
+func calculateMaintainability(lines, commentLines int, avgComplexity float64) float64 {
+	if lines == 0 {
+		return 100.0
+	}
+	commentRatio := float64(commentLines) / float64(lines)
+	idx := 100 - (float64(lines)/100 + avgComplexity*2 - commentRatio*50)
+	if idx < 0 {
+		return 0
+	}
+	if idx > 100 {
+		return 100
+	}
+	return idx
+}
+
+// generateMarkdown writes the Markdown summary.
+func generateMarkdown(summaries []CodeSummary, overview ProjectOverview, outputPath string) error {
+	var b strings.Builder
+
+	b.WriteString("# 📝 Go Code Summary\n\n")
+	b.WriteString("## 📊 Project Overview\n\n")
+	if overview.TotalFiles == 0 {
+		b.WriteString("No Go files found.\n\n")
+	} else {
+		b.WriteString(fmt.Sprintf("- 📂 Files Processed: %d\n", overview.TotalFiles))
+		b.WriteString(fmt.Sprintf("- 📏 Total Lines of Code: %d\n", overview.TotalLines))
+		b.WriteString(fmt.Sprintf("- 🧾 Source / Comment / Blank Lines: %d / %d / %d\n", overview.TotalSourceLines, overview.TotalCommentLines, overview.TotalBlankLines))
+		b.WriteString(fmt.Sprintf("- ✍️ Handwritten Lines: %d\n", overview.HandwrittenLines))
+		b.WriteString(fmt.Sprintf("- 🤖 Generated Lines: %d (%d files)\n", overview.GeneratedLines, overview.GeneratedFiles))
+		b.WriteString(fmt.Sprintf("- 🛠️ Total Functions: %d\n", overview.TotalFunctions))
+		b.WriteString(fmt.Sprintf("- ⚠️ Long Functions (>50 lines): %d\n", overview.TotalLongFuncs))
+		b.WriteString(fmt.Sprintf("- 📜 Average Comment-to-Code Ratio: %.2f%%\n", overview.AvgCommentRatio))
+		b.WriteString(fmt.Sprintf("- 🧠 Average Function Complexity: %.2f\n", overview.AvgComplexity))
+		b.WriteString(fmt.Sprintf("- 🧩 Average Cognitive Complexity: %.2f\n", overview.AvgCognitive))
+		b.WriteString(fmt.Sprintf("- 🛡️ Average Maintainability Index: %.2f\n", overview.AvgMaintainability))
+		b.WriteString(fmt.Sprintf("- 📖 Godoc Coverage: %.2f%% (%d of %d items)\n", overview.GodocCoverage, overview.DocumentedItems, overview.DocumentableItems))
+		b.WriteString(fmt.Sprintf("- 🧹 Doc Comment Findings: %d\n", len(overview.DocFindings)))
+		b.WriteString(fmt.Sprintf("- 🎯 Total Test Coverage: %s\n", overview.CoverageSummary()))
+		if len(overview.TestResults) > 0 {
+			b.WriteString(fmt.Sprintf("- ✅ Test Results: %d passed, %d failed (%d flaky), %d skipped over %d runs\n", overview.TestsPassed, overview.TestsFailed,
+				len(overview.FlakyTests), overview.TestsSkipped, overview.TestRuns))
+		} else if overview.TestRuns > 0 {
+			b.WriteString(fmt.Sprintf("- ✅ Test Results: none reported (%d runs requested)\n", overview.TestRuns))
+		}
+		b.WriteString(fmt.Sprintf("- 📦 Packages: %d\n", overview.PackageCount))
+		b.WriteString(fmt.Sprintf("- 🔗 External Dependencies: %d modules\n", overview.DependencyCount))
+		b.WriteString(fmt.Sprintf("- 📚 Imported Packages (stdlib / internal / external): %d / %d / %d\n", overview.StdlibImports, overview.InternalImports, overview.ExternalImports))
+		b.WriteString(fmt.Sprintf("- 🏥 Project Health Score: %.2f/100\n", overview.ProjectHealth))
+		b.WriteString(fmt.Sprintf("- 🚨 Risky Files: %d\n", overview.RiskyFiles))
+		b.WriteString(fmt.Sprintf("- ⏰ Estimated Refactoring Effort: %.2f hours\n", overview.EffortHours))
+		b.WriteString(fmt.Sprintf("- 🙈 Excluded Paths: %d\n", len(overview.Excluded)))
+		b.WriteString(fmt.Sprintf("- 🚧 Architecture Rule Violations: %d\n", len(overview.RuleViolations)))
+		if overview.RaceDetector && len(overview.TestResults) == 0 {
+			b.WriteString("- 🏁 Data Races: unknown, the race detector was on but no tests reported results\n")
+		} else if overview.RaceDetector {
+			b.WriteString(fmt.Sprintf("- 🏁 Data Races: %d\n", len(overview.DataRaces)))
+		}
+		b.WriteString("### ⚡ Immediate Attention Required\n\n")
+		foundProblems := false
+		for _, summary := range summaries {
+			if summary.Generated && !overview.IncludeGenerated {
+				continue
+			}
+			if len(summary.Problems) != 0 {
+				foundProblems = true
+				for _, problem := range summary.Problems {
+					b.WriteString(fmt.Sprintf("\t- ❗ Function %s at %s Needs Refactoring: %s\n",
+						problem.FunctionName, problem.Position, problem.Reason))
+				}
+			}
+		}
+		for _, race := range overview.DataRaces {
+			for _, f := range race.Functions {
+				foundProblems = true
+				b.WriteString(fmt.Sprintf("\t- 🏁 Function %s at %s is involved in %s\n", f.Name, f.Position, race.Summary()))
+			}
+		}
+		if !foundProblems {
+			b.WriteString("\t - Nothing immediate to fix\n\n")
+		}
+		if len(overview.HighestRisk) > 0 {
+			b.WriteString("\n### 🎯 Highest Risk\n\n")
+			b.WriteString("| Function | Position | Cyclomatic | Coverage | CRAP |\n")
+			b.WriteString("|----------|----------|------------|----------|------|\n")
+			for _, f := range overview.HighestRisk {
+				b.WriteString(fmt.Sprintf("| %s | %s | %d | %.2f%% | %.2f |\n", f.Function, f.Position, f.Complexity, f.Coverage, f.CRAP))
+			}
+		}
+
+		b.WriteString("\n### 📦 Package Breakdown\n\n")
+		if len(overview.PackageMetrics) == 0 {
+			b.WriteString("No packages found.\n\n")
+		} else {
+			b.WriteString("| Package | Files | Lines | SLOC | Comments | Imports | Ca | Ce | Instability | Abstractness | Distance | Zone | Coverage |\n")
+			b.WriteString("|---------|-------|-------|------|----------|---------|----|----|-------------|--------------|----------|------|----------|\n")
+			pkgs := make([]string, 0, len(overview.PackageMetrics))
+			for pkg := range overview.PackageMetrics {
+				pkgs = append(pkgs, pkg)
+			}
+			sort.Strings(pkgs)
+			for _, pkg := range pkgs {
+				metric := overview.PackageMetrics[pkg]
+				coverage := "-"
+				if metric.Statements > 0 {
+					coverage = fmt.Sprintf("%.2f%%", metric.Coverage)
+				}
+				ca, ce, instability, distance := zoneUnknown, zoneUnknown, zoneUnknown, zoneUnknown
+				if overview.CouplingNote == "" {
+					ca, ce, instability = strconv.Itoa(metric.Afferent), strconv.Itoa(metric.Efferent), fmt.Sprintf("%.2f", metric.Instability)
+					distance = fmt.Sprintf("%.2f", metric.Distance)
+				}
+				if metric.Zone == zoneIsolated {
+					distance = "-"
+				}
+				b.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %d | %d | %s | %s | %s | %.2f | %s | %s | %s |\n", pkg, metric.FileCount, metric.LineCount, metric.SourceLines, metric.CommentLines,
+					metric.ImportCount, ca, ce, instability, metric.Abstractness, distance, metric.Zone, coverage))
+			}
+			b.WriteString("\n")
+			if overview.CouplingNote != "" {
+				b.WriteString(fmt.Sprintf("Coupling, instability and distance are n/a: %s.\n\n", overview.CouplingNote))
+			}
+		}
+
+		if len(overview.TestInventory) > 0 {
+			b.WriteString("### 🧪 Test Inventory\n\n")
+			b.WriteString("| Package | Test Files | Tests | Benchmarks | Fuzz | Examples | Table-Driven | Test/Code LOC | Untested Exports |\n")
+			b.WriteString("|---------|------------|-------|------------|------|----------|--------------|---------------|------------------|\n")
+			for _, inv := range overview.TestInventory {
+				b.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %d | %d | %d | %.2f | %d |\n", inv.Package, inv.TestFiles, inv.Tests,
+					inv.Benchmarks, inv.Fuzzes, inv.Examples, inv.TableDriven, inv.TestToCodeRatio, len(inv.Untested)))
+			}
+			b.WriteString("\n")
+			for _, inv := range overview.TestInventory {
+				if len(inv.Untested) > 0 {
+					b.WriteString(fmt.Sprintf("- 🕳️ %s: `%s`\n", inv.Package, strings.Join(inv.Untested, "`, `")))
+				}
+			}
+			b.WriteString("\n")
+		}
+
+		if len(overview.TestResults) > 0 {
+			b.WriteString("### ✅ Test Results\n\n")
+			b.WriteString("| Package | Status | Passed | Failed | Flaky | Skipped | Duration |\n")
+			b.WriteString("|---------|--------|--------|--------|-------|---------|----------|\n")
+			for _, pkg := range overview.TestResults {
+				b.WriteString(fmt.Sprintf("| %s | %s | %d | %d | %d | %d | %.2fs |\n", pkg.Package, pkg.Status, pkg.Passed, pkg.Failed, pkg.Flaky, pkg.Skipped, pkg.Elapsed))
+			}
+			b.WriteString("\n")
+			for _, pkg := range overview.TestResults {
+				for _, t := range pkg.Tests {
+					if t.Status == testFail {
+						b.WriteString(fmt.Sprintf("- ❌ %s `%s` (failed %d of %d runs, %.2fs)\n\n```text\n%s```\n\n", pkg.Package, t.Name, t.Failures, t.Runs, t.Elapsed, t.Output))
+					}
+				}
+				if pkg.Output != "" {
+					b.WriteString(fmt.Sprintf("- ❌ %s\n\n```text\n%s```\n\n", pkg.Package, pkg.Output))
+				}
+			}
+		}
+
+		if len(overview.FlakyTests) > 0 {
+			b.WriteString("### 🎲 Flaky Tests\n\n")
+			b.WriteString("| Package | Test | Failed Runs | Mean | p95 |\n")
+			b.WriteString("|---------|------|-------------|------|-----|\n")
+			for _, t := range overview.FlakyTests {
+				b.WriteString(fmt.Sprintf("| %s | %s | %d of %d | %.2fs | %.2fs |\n", t.Package, t.Name, t.Failures, t.Runs, t.Elapsed, t.P95))
+			}
+			b.WriteString("\n")
+		}
+		if len(overview.SlowestTests) > 0 {
+			b.WriteString("### 🐢 Slowest Tests\n\n")
+			b.WriteString("| Package | Test | Status | Runs | Mean | p95 |\n")
+			b.WriteString("|---------|------|--------|------|------|-----|\n")
+			for _, t := range overview.SlowestTests {
+				b.WriteString(fmt.Sprintf("| %s | %s | %s | %d | %.2fs | %.2fs |\n", t.Package, t.Name, t.Status, t.Runs, t.Elapsed, t.P95))
+			}
+			b.WriteString("\n")
+		}
+
+		if len(overview.ExternalModules) > 0 {
+			b.WriteString("### 🔗 External Modules\n\n")
+			b.WriteString("| Module | Version | Requirement | Imported Packages | Used By |\n")
+			b.WriteString("|--------|---------|-------------|-------------------|---------|\n")
+			for _, m := range overview.ExternalModules {
+				b.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n", m.Path, m.Version, m.Requirement, strings.Join(m.Imports, ", "), strings.Join(m.UsedBy, ", ")))
+			}
+			b.WriteString("\n")
+		}
+		if len(overview.Implementations) > 0 {
+			b.WriteString("### 🧩 Interface Implementations\n\n")
+			for _, impl := range overview.Implementations {
+				b.WriteString(fmt.Sprintf("- `%s`: `%s`\n", impl.Interface, strings.Join(impl.Implementers, "`, `")))
+			}
+			b.WriteString("\n")
+		}
+		if len(overview.UndocumentedPkgs) > 0 || len(overview.Undocumented) > 0 {
+			b.WriteString("### 📝 Undocumented Exports\n\n")
+			for _, pkg := range overview.UndocumentedPkgs {
+				b.WriteString(fmt.Sprintf("- package `%s`: no package comment\n", pkg))
+			}
+			for _, item := range overview.Undocumented {
+				b.WriteString(fmt.Sprintf("- %s: %s `%s`\n", item.Position, item.Kind, item.Name))
+			}
+			b.WriteString("\n")
+		}
+		if len(overview.DocFindings) > 0 {
+			b.WriteString("### 🧹 Doc Comment Findings\n\n")
+			for _, finding := range overview.DocFindings {
+				b.WriteString(fmt.Sprintf("- %s: %s `%s`: %s\n", finding.Position, finding.Kind, finding.Name, finding.Message))
+			}
+			b.WriteString("\n")
+		}
+		if len(overview.DataRaces) > 0 {
+			b.WriteString("### 🏁 Data Races\n\n")
+			for _, race := range overview.DataRaces {
+				test := race.Test
+				if test == "" {
+					test = "outside any test"
+				}
+				b.WriteString(fmt.Sprintf("- %s `%s`", race.Package, test))
+				if race.Count > 1 {
+					b.WriteString(fmt.Sprintf(" (reported %d times)", race.Count))
+				}
+				for i, f := range race.Functions {
+					sep := ", "
+					if i == 0 {
+						sep = ": "
+					}
+					b.WriteString(fmt.Sprintf("%s`%s` (%s)", sep, f.Name, f.Position))
+				}
+				b.WriteString(fmt.Sprintf("\n\n```text\n%s```\n\n", race.Stacks()))
+			}
+		}
+		if len(overview.RuleViolations) > 0 {
+			b.WriteString("### 🚧 Architecture Rule Violations\n\n")
+			for _, v := range overview.RuleViolations {
+				b.WriteString(fmt.Sprintf("- %s: %s (rule: %s)\n", v.Position, v.Message, v.Rule))
+			}
+			b.WriteString("\n")
+		}
+		if len(overview.Excluded) > 0 {
+			b.WriteString("### 🙈 Excluded Paths\n\n")
+			b.WriteString("| Path | Reason |\n")
+			b.WriteString("|------|--------|\n")
+			for _, e := range overview.Excluded {
+				b.WriteString(fmt.Sprintf("| %s | %s |\n", e.Path, e.Reason))
+			}
+			b.WriteString("\n")
+		}
+		if overview.TypeErrors > 0 {
+			b.WriteString(fmt.Sprintf("⚠️ Type checking reported %d errors; resolved types may be incomplete.\n\n", overview.TypeErrors))
+		}
+	}
+
+	for _, summary := range summaries {
+		commentRatio := commentPercent(summary.CommentLines, summary.SourceLines)
+		maxFuncLines := 0
+		for _, f := range summary.Functions {
+			if f.LineCount > maxFuncLines {
+				maxFuncLines = f.LineCount
+			}
+		}
+		b.WriteString(fmt.Sprintf("## 📂 %s (%s)\n\n", summary.Filename, summary.Package))
+		b.WriteString("📈 ***Metrics***:\n")
+		b.WriteString(fmt.Sprintf("- 📦 Import Path: %s\n", summary.ImportPath))
+		if summary.Generated {
+			b.WriteString("- 🤖 Generated: yes\n")
+		}
+		b.WriteString(fmt.Sprintf("- 📏 Lines of Code: %d\n", summary.Lines))
+		b.WriteString(fmt.Sprintf("- 🧾 Source / Comment / Blank / Mixed Lines: %d / %d / %d / %d\n", summary.SourceLines, summary.CommentLines, summary.BlankLines, summary.MixedLines))
+		b.WriteString(fmt.Sprintf("- 🛠️ Number of Functions: %d\n", len(summary.Functions)))
+		b.WriteString(fmt.Sprintf("- 📏 Largest Function: %d lines\n", maxFuncLines))
+		b.WriteString(fmt.Sprintf("- ⚠️ Long Functions (>50 lines): %d\n", len(summary.LongFunctions)))
+		b.WriteString(fmt.Sprintf("- 📜 Comment-to-Code Ratio: %.2f%%\n", commentRatio))
+		b.WriteString(fmt.Sprintf("- 🧠 Average Function Complexity: %.2f\n", summary.AvgComplexity))
+		b.WriteString(fmt.Sprintf("- 🧩 Average Cognitive Complexity: %.2f\n", summary.AvgCognitive))
+		b.WriteString(fmt.Sprintf("- 📖 Godoc Coverage: %.2f%% (%d of %d items)\n", summary.GodocCoverage, summary.DocumentedItems, summary.DocumentableItems))
+		if summary.HasCoverage {
+			b.WriteString(fmt.Sprintf("- 🎯 Test Coverage: %.2f%% (%d of %d statements)\n", summary.TestCoverage, summary.CoveredStatements, summary.Statements))
+		}
+		b.WriteString(fmt.Sprintf("- 🔲 Max Function Depth: %d\n", summary.MaxFunctionDepth))
+		b.WriteString(fmt.Sprintf("- 🛡️ Maintainability Index: %.2f\n", summary.MaintainabilityIdx))
+		b.WriteString(fmt.Sprintf("- 🧮 Halstead Volume / Difficulty / Effort: %.2f / %.2f / %.2f\n", summary.Halstead.Volume, summary.Halstead.Difficulty, summary.Halstead.Effort))
+		b.WriteString(fmt.Sprintf("- 🔗 External Dependencies: %d\n\n", summary.ExternalImportCount()))
+
+		if len(summary.Types) > 0 {
+			b.WriteString("### 🏗️ Types\n\n")
+			for _, t := range summary.Types {
+				if t.Comment != "" {
+					b.WriteString(fmt.Sprintf("%s\n\n", t.Comment))
+				}
+				b.WriteString(fmt.Sprintf("```go\n%s\n```\n\n", t.Definition))
+				b.WriteString(fmt.Sprintf("📍 %s\n\n", t.Position))
+				if len(t.Implements) > 0 {
+					b.WriteString(fmt.Sprintf("🧩 Implements: `%s`\n\n", strings.Join(t.Implements, "`, `")))
+				}
+				if t.MethodCount > 0 {
+					b.WriteString(fmt.Sprintf("🔧 Methods: %d, total complexity %d\n\n", t.MethodCount, t.MethodComplexity))
+					b.WriteString("| Method | Receiver | Cyclomatic | Cognitive | Location |\n")
+					b.WriteString("|--------|----------|------------|-----------|----------|\n")
+					for _, m := range t.Methods {
+						receiver := "value"
+						if m.Pointer {
+							receiver = "pointer"
+						}
+						b.WriteString(fmt.Sprintf("| %s | %s | %d | %d | %s |\n", m.Name, receiver, m.Complexity, m.Cognitive, m.Position))
+					}
+					b.WriteString("\n")
+				}
+			}
+		}
+
+		if len(summary.Functions) > 0 {
+			b.WriteString("### 📋 Function Metrics\n\n")
+			b.WriteString("| Function | Span | Lines | SLOC | Cyclomatic | Cognitive | Depth | Halstead Volume | Maintainability | Coverage | CRAP |\n")
+			b.WriteString("|----------|------|-------|------|------------|-----------|-------|-----------------|-----------------|----------|------|\n")
+			for _, f := range summary.Functions {
+				coverage, crap := "-", "-"
+				if summary.HasCoverage {
+					coverage, crap = fmt.Sprintf("%.2f%%", f.Coverage), fmt.Sprintf("%.2f", f.CRAP)
+				}
+				b.WriteString(fmt.Sprintf("| %s | %d-%d | %d | %d | %d | %d | %d | %.2f | %.2f | %s | %s |\n", f.Name, f.Position.Line, f.Position.EndLine, f.LineCount, f.SourceLines, f.Complexity, f.Cognitive, f.MaxDepth,
+					f.Halstead.Volume, f.Maintainability, coverage, crap))
+			}
+			b.WriteString("\n")
+
+			b.WriteString("### 🛠️ Functions\n\n")
+			for _, f := range summary.Functions {
+				if f.Comment != "" {
+					b.WriteString(fmt.Sprintf("%s\n\n", f.Comment))
+				}
+				b.WriteString(fmt.Sprintf("```go\n%s\n```\n\n", f.Signature))
+				b.WriteString(fmt.Sprintf("📍 %s\n\n", f.Position))
+			}
+		}
+	}
+
+	return os.WriteFile(outputPath, []byte(b.String()), 0644)
+}
+
+// sourceLinker builds the HTML links from report entries to their source. The pattern's
+// {path}, {line} and {endline} placeholders are replaced by the slash-separated path relative
+// to the analyzed root and the entry's first and last line; without a pattern, entries link to
+// the local file.
+type sourceLinker struct {
+	root    string
+	pattern string
+}
+
+// URL returns the link for pos.
+func (l sourceLinker) URL(pos Position) template.URL {
+	file, err := filepath.Abs(pos.File)
+	if err != nil {
+		file = pos.File
+	}
+	if l.pattern == "" {
+		return template.URL((&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String())
+	}
+	rel := file
+	if root, err := filepath.Abs(l.root); err == nil {
+		if r, err := filepath.Rel(root, file); err == nil {
+			rel = r
+		}
+	}
+	replacer := strings.NewReplacer(
+		"{path}", (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath(),
+		"{line}", strconv.Itoa(pos.Line),
+		"{endline}", strconv.Itoa(pos.EndLine),
+	)
+	return template.URL(replacer.Replace(l.pattern))
+}
+
+// generateHTML writes the HTML summary with visualizations.
+func generateHTML(summaries []CodeSummary, overview ProjectOverview, linker sourceLinker, outputPath string) error {
+	const htmlTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Go Code Summary</title>
+    <script src="https://cdn.tailwindcss.com"></script>
+    <script src="https://cdn.jsdelivr.net/npm/chart.js"></script>
+    <style>
+        pre { background-color: #1f2937; color: #e5e7eb; padding: 1rem; border-radius: 0.5rem; }
+        code { font-family: monospace; }
+    </style>
+</head>
+<body class="bg-gray-100 font-sans">
+    <div class="container mx-auto p-4">
+        <h1 class="text-3xl font-bold mb-4">📝 Go Code Summary</h1>
+        <h2 class="text-2xl font-semibold mb-2">📊 Project Overview</h2>
+        {{if eq .ProjectOverview.TotalFiles 0}}
+        <p>No Go files found.</p>
+        {{else}}
+        <ul class="list-disc ml-6 mb-4">
+            <li>📂 Files Processed: {{.ProjectOverview.TotalFiles}}</li>
+            <li>📏 Total Lines of Code: {{.ProjectOverview.TotalLines}}</li>
+            <li>🧾 Source / Comment / Blank Lines: {{.ProjectOverview.TotalSourceLines}} / {{.ProjectOverview.TotalCommentLines}} / {{.ProjectOverview.TotalBlankLines}}</li>
+            <li>✍️ Handwritten Lines: {{.ProjectOverview.HandwrittenLines}}</li>
+            <li>🤖 Generated Lines: {{.ProjectOverview.GeneratedLines}} ({{.ProjectOverview.GeneratedFiles}} files)</li>
+            <li>🛠️ Total Functions: {{.ProjectOverview.TotalFunctions}}</li>
+            <li>⚠️ Long Functions (>50 lines): {{.ProjectOverview.TotalLongFuncs}}</li>
+            <li>📜 Average Comment-to-Code Ratio: {{printf "%.2f" .ProjectOverview.AvgCommentRatio}}%</li>
+            <li>🧠 Average Function Complexity: {{printf "%.2f" .ProjectOverview.AvgComplexity}}</li>
+            <li>🧩 Average Cognitive Complexity: {{printf "%.2f" .ProjectOverview.AvgCognitive}}</li>
+            <li>🛡️ Average Maintainability Index: {{printf "%.2f" .ProjectOverview.AvgMaintainability}}</li>
+            <li>📖 Godoc Coverage: {{printf "%.2f" .ProjectOverview.GodocCoverage}}% ({{.ProjectOverview.DocumentedItems}} of {{.ProjectOverview.DocumentableItems}} items)</li>
+            <li>🧹 Doc Comment Findings: {{len .ProjectOverview.DocFindings}}</li>
+			<li>🎯 Total Test Coverage: {{.ProjectOverview.CoverageSummary}}</li>
+            {{if .ProjectOverview.TestResults}}
+            <li>✅ Test Results: {{.ProjectOverview.TestsPassed}} passed, {{.ProjectOverview.TestsFailed}} failed ({{len .ProjectOverview.FlakyTests}} flaky), {{.ProjectOverview.TestsSkipped}} skipped over {{.ProjectOverview.TestRuns}} runs</li>
+            {{else if .ProjectOverview.TestRuns}}
+            <li>✅ Test Results: none reported ({{.ProjectOverview.TestRuns}} runs requested)</li>
+            {{end}}
+            <li>📦 Packages: {{.ProjectOverview.PackageCount}}</li>
+            <li>🔗 External Dependencies: {{.ProjectOverview.DependencyCount}} modules</li>
+            <li>📚 Imported Packages (stdlib / internal / external): {{.ProjectOverview.StdlibImports}} / {{.ProjectOverview.InternalImports}} / {{.ProjectOverview.ExternalImports}}</li>
+            <li>🏥 Project Health Score: {{printf "%.2f" .ProjectOverview.ProjectHealth}}/100</li>
+            <li>🚨 Risky Files: {{.ProjectOverview.RiskyFiles}}</li>
+            <li>⏰ Estimated Refactoring Effort: {{printf "%.2f" .ProjectOverview.EffortHours}} hours</li>
+            <li>🙈 Excluded Paths: {{len .ProjectOverview.Excluded}}</li>
+            <li>🚧 Architecture Rule Violations: {{len .ProjectOverview.RuleViolations}}</li>
+            {{if and .ProjectOverview.RaceDetector (not .ProjectOverview.TestResults)}}
+            <li>🏁 Data Races: unknown, the race detector was on but no tests reported results</li>
+            {{else if .ProjectOverview.RaceDetector}}
+            <li>🏁 Data Races: {{len .ProjectOverview.DataRaces}}</li>
+            {{end}}
+			{{range .Summaries}}
+				{{if and .CodeSummary.Problems (or (not .CodeSummary.Generated) $.ProjectOverview.IncludeGenerated)}}
+				<li> ⚡ Problems to address immediately</li>
+					📂 In File {{ .CodeSummary.Filename }}
+					<ul class="list-disc ml-6 mb-4">
+						{{range .CodeSummary.Problems}}
+							<li>❗Function <a class="text-blue-600" href="{{sourceURL .Position}}">{{.FunctionName}}</a> Needs Refactoring: {{.Reason}}</li>
+						{{end}}
+					</ul>
+				{{end}}
+			{{end}}
+			{{range .ProjectOverview.DataRaces}}
+				{{$race := .}}
+				{{range .Functions}}
+				<li>🏁 Function <a class="text-blue-600" href="{{sourceURL .Position}}">{{.Name}}</a> is involved in {{$race.Summary}}</li>
+				{{end}}
+			{{end}}
+        </ul>
+        {{if .ProjectOverview.HighestRisk}}
+        <h3 class="text-lg font-medium mb-2">🎯 Highest Risk</h3>
+        <table class="table-auto mb-4 bg-white rounded-lg shadow">
+            <thead>
+                <tr><th class="px-2">Function</th><th class="px-2">Position</th><th class="px-2">Cyclomatic</th><th class="px-2">Coverage</th><th class="px-2">CRAP</th></tr>
+            </thead>
+            <tbody>
+                {{range .ProjectOverview.HighestRisk}}
+                <tr><td class="px-2"><a class="text-blue-600" href="{{sourceURL .Position}}">{{.Function}}</a></td><td class="px-2">{{.Position}}</td><td class="px-2">{{.Complexity}}</td><td class="px-2">{{printf "%.2f" .Coverage}}%</td><td class="px-2">{{printf "%.2f" .CRAP}}</td></tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{end}}
+        <h3 class="text-lg font-medium mb-2">📦 Package Breakdown</h3>
+        {{if .ProjectOverview.PackageMetrics}}
+        <div class="grid grid-cols-1 md:grid-cols-2 gap-4 mb-4">
+            <canvas id="packageChart"></canvas>
+            <canvas id="sequenceChart"></canvas>
+        </div>
+        <script>
+            const ctx = document.getElementById('packageChart').getContext('2d');
+            new Chart(ctx, {
+                type: 'bar',
+                data: {
+                    labels: [{{range $pkg, $metric := .ProjectOverview.PackageMetrics}}'{{$pkg}}',{{end}}],
+                    datasets: [{
+                        label: 'File Count',
+                        data: [{{range $pkg, $metric := .ProjectOverview.PackageMetrics}}{{$metric.FileCount}},{{end}}],
+                        backgroundColor: '#3b82f6',
+                    }, {
+                        label: 'Source Lines',
+                        data: [{{range $pkg, $metric := .ProjectOverview.PackageMetrics}}{{$metric.SourceLines}},{{end}}],
+                        backgroundColor: '#10b981',
+                    }]
+                },
+                options: { scales: { y: { beginAtZero: true } } }
+            });
+            new Chart(document.getElementById('sequenceChart').getContext('2d'), {
+                type: 'scatter',
+                data: {
+                    datasets: [{
+                        label: 'Packages',
+                        data: [{{range $pkg, $metric := .ProjectOverview.PackageMetrics}}{{if and (ne $metric.Zone "n/a") (ne $metric.Zone "isolated")}}{x: {{$metric.Instability}}, y: {{$metric.Abstractness}}, pkg: '{{$pkg}}', zone: '{{$metric.Zone}}'},{{end}}{{end}}],
+                        backgroundColor: '#8b5cf6',
+                    }, {
+                        label: 'Main Sequence',
+                        type: 'line',
+                        data: [{x: 0, y: 1}, {x: 1, y: 0}],
+                        borderColor: '#9ca3af',
+                        pointRadius: 0,
+                    }]
+                },
+                options: {
+                    scales: {
+                        x: { min: 0, max: 1, title: { display: true, text: 'Instability (I)' } },
+                        y: { min: 0, max: 1, title: { display: true, text: 'Abstractness (A)' } }
+                    },
+                    plugins: {
+                        tooltip: { callbacks: { label: (item) => item.raw.pkg ? item.raw.pkg + ' (' + item.raw.zone + ')' : 'main sequence' } }
+                    }
+                }
+            });
+        </script>
+        <table class="table-auto mb-4 bg-white rounded-lg shadow">
+            <thead>
+                <tr><th class="px-2">Package</th><th class="px-2">Files</th><th class="px-2">Lines</th><th class="px-2">SLOC</th><th class="px-2">Comments</th><th class="px-2">Imports</th><th class="px-2">Ca</th><th class="px-2">Ce</th><th class="px-2">Instability</th><th class="px-2">Abstractness</th><th class="px-2">Distance</th><th class="px-2">Zone</th><th class="px-2">Coverage</th></tr>
+            </thead>
+            <tbody>
+                {{range $pkg, $metric := .ProjectOverview.PackageMetrics}}
+                <tr><td class="px-2">{{$pkg}}</td><td class="px-2">{{$metric.FileCount}}</td><td class="px-2">{{$metric.LineCount}}</td><td class="px-2">{{$metric.SourceLines}}</td><td class="px-2">{{$metric.CommentLines}}</td><td class="px-2">{{$metric.ImportCount}}</td>{{if $.ProjectOverview.CouplingNote}}<td class="px-2">n/a</td><td class="px-2">n/a</td><td class="px-2">n/a</td>{{else}}<td class="px-2">{{$metric.Afferent}}</td><td class="px-2">{{$metric.Efferent}}</td><td class="px-2">{{printf "%.2f" $metric.Instability}}</td>{{end}}<td class="px-2">{{printf "%.2f" $metric.Abstractness}}</td><td class="px-2">{{if $.ProjectOverview.CouplingNote}}n/a{{else if eq $metric.Zone "isolated"}}-{{else}}{{printf "%.2f" $metric.Distance}}{{end}}</td><td class="px-2">{{$metric.Zone}}</td><td class="px-2">{{if $metric.Statements}}{{printf "%.2f" $metric.Coverage}}%{{else}}-{{end}}</td></tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{if .ProjectOverview.CouplingNote}}
+        <p class="mb-4">Coupling, instability and distance are n/a: {{.ProjectOverview.CouplingNote}}.</p>
+        {{end}}
+        {{else}}
+        <p>No packages found.</p>
+        {{end}}
+        {{if .ProjectOverview.TestInventory}}
+        <h3 class="text-lg font-medium mb-2">🧪 Test Inventory</h3>
+        <table class="table-auto mb-4 bg-white rounded-lg shadow">
+            <thead>
+                <tr><th class="px-2">Package</th><th class="px-2">Test Files</th><th class="px-2">Tests</th><th class="px-2">Benchmarks</th><th class="px-2">Fuzz</th><th class="px-2">Examples</th><th class="px-2">Table-Driven</th><th class="px-2">Test/Code LOC</th><th class="px-2">Untested Exports</th></tr>
+            </thead>
+            <tbody>
+                {{range .ProjectOverview.TestInventory}}
+                <tr>
+                    <td class="px-2">{{.Package}}</td><td class="px-2">{{.TestFiles}}</td><td class="px-2">{{.Tests}}</td><td class="px-2">{{.Benchmarks}}</td><td class="px-2">{{.Fuzzes}}</td><td class="px-2">{{.Examples}}</td><td class="px-2">{{.TableDriven}}</td><td class="px-2">{{printf "%.2f" .TestToCodeRatio}}</td>
+                    <td class="px-2">{{range $i, $name := .Untested}}{{if $i}}, {{end}}<code>{{$name}}</code>{{end}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{end}}
+        {{if .ProjectOverview.TestResults}}
+        <h3 class="text-lg font-medium mb-2">✅ Test Results</h3>
+        <table class="table-auto mb-4 bg-white rounded-lg shadow">
+            <thead>
+                <tr><th class="px-2">Package</th><th class="px-2">Status</th><th class="px-2">Passed</th><th class="px-2">Failed</th><th class="px-2">Flaky</th><th class="px-2">Skipped</th><th class="px-2">Duration</th></tr>
+            </thead>
+            <tbody>
+                {{range .ProjectOverview.TestResults}}
+                <tr><td class="px-2">{{.Package}}</td><td class="px-2">{{.Status}}</td><td class="px-2">{{.Passed}}</td><td class="px-2">{{.Failed}}</td><td class="px-2">{{.Flaky}}</td><td class="px-2">{{.Skipped}}</td><td class="px-2">{{printf "%.2f" .Elapsed}}s</td></tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{range .ProjectOverview.TestResults}}
+        {{$pkg := .Package}}
+        {{range .Tests}}
+        {{if eq .Status "fail"}}
+        <details class="mb-4">
+            <summary class="cursor-pointer">❌ {{$pkg}} <code>{{.Name}}</code> (failed {{.Failures}} of {{.Runs}} runs, {{printf "%.2f" .Elapsed}}s)</summary>
+            <pre class="bg-gray-100 p-2 overflow-x-auto"><code>{{.Output}}</code></pre>
+        </details>
+        {{end}}
+        {{end}}
+        {{if .Output}}
+        <details class="mb-4">
+            <summary class="cursor-pointer">❌ {{.Package}}</summary>
+            <pre class="bg-gray-100 p-2 overflow-x-auto"><code>{{.Output}}</code></pre>
+        </details>
+        {{end}}
+        {{end}}
+        {{end}}
+        {{if .ProjectOverview.FlakyTests}}
+        <h3 class="text-lg font-medium mb-2">🎲 Flaky Tests</h3>
+        <table class="table-auto mb-4 bg-white rounded-lg shadow">
+            <thead>
+                <tr><th class="px-2">Package</th><th class="px-2">Test</th><th class="px-2">Failed Runs</th><th class="px-2">Mean</th><th class="px-2">p95</th></tr>
+            </thead>
+            <tbody>
+                {{range .ProjectOverview.FlakyTests}}
+                <tr><td class="px-2">{{.Package}}</td><td class="px-2"><code>{{.Name}}</code></td><td class="px-2">{{.Failures}} of {{.Runs}}</td><td class="px-2">{{printf "%.2f" .Elapsed}}s</td><td class="px-2">{{printf "%.2f" .P95}}s</td></tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{end}}
+        {{if .ProjectOverview.SlowestTests}}
+        <h3 class="text-lg font-medium mb-2">🐢 Slowest Tests</h3>
+        <table class="table-auto mb-4 bg-white rounded-lg shadow">
+            <thead>
+                <tr><th class="px-2">Package</th><th class="px-2">Test</th><th class="px-2">Status</th><th class="px-2">Runs</th><th class="px-2">Mean</th><th class="px-2">p95</th></tr>
+            </thead>
+            <tbody>
+                {{range .ProjectOverview.SlowestTests}}
+                <tr><td class="px-2">{{.Package}}</td><td class="px-2"><code>{{.Name}}</code></td><td class="px-2">{{.Status}}</td><td class="px-2">{{.Runs}}</td><td class="px-2">{{printf "%.2f" .Elapsed}}s</td><td class="px-2">{{printf "%.2f" .P95}}s</td></tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{end}}
+        {{if .ProjectOverview.ExternalModules}}
+        <h3 class="text-lg font-medium mb-2">🔗 External Modules</h3>
+        <table class="table-auto mb-4 bg-white rounded-lg shadow">
+            <thead>
+                <tr><th class="px-2">Module</th><th class="px-2">Version</th><th class="px-2">Requirement</th><th class="px-2">Imported Packages</th><th class="px-2">Used By</th></tr>
+            </thead>
+            <tbody>
+                {{range .ProjectOverview.ExternalModules}}
+                <tr>
+                    <td class="px-2"><code>{{.Path}}</code></td><td class="px-2">{{.Version}}</td><td class="px-2">{{.Requirement}}</td>
+                    <td class="px-2">{{range $i, $p := .Imports}}{{if $i}}, {{end}}<code>{{$p}}</code>{{end}}</td><td class="px-2">{{range $i, $p := .UsedBy}}{{if $i}}, {{end}}<code>{{$p}}</code>{{end}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{end}}
+        {{if .ProjectOverview.Implementations}}
+        <h3 class="text-lg font-medium mb-2">🧩 Interface Implementations</h3>
+        <ul class="list-disc ml-6 mb-4">
+            {{range .ProjectOverview.Implementations}}
+            <li><code>{{.Interface}}</code>: {{range $i, $t := .Implementers}}{{if $i}}, {{end}}<code>{{$t}}</code>{{end}}</li>
+            {{end}}
+        </ul>
+        {{end}}
+        {{if or .ProjectOverview.UndocumentedPkgs .ProjectOverview.Undocumented}}
+        <details class="mb-4">
+            <summary class="text-lg font-medium cursor-pointer">📝 Undocumented Exports</summary>
+            <ul class="list-disc ml-6">
+                {{range .ProjectOverview.UndocumentedPkgs}}
+                <li>package <code>{{.}}</code>: no package comment</li>
+                {{end}}
+                {{range .ProjectOverview.Undocumented}}
+                <li><a class="text-blue-600" href="{{sourceURL .Position}}">{{.Position}}</a>: {{.Kind}} <code>{{.Name}}</code></li>
+                {{end}}
+            </ul>
+        </details>
+        {{end}}
+        {{if .ProjectOverview.DocFindings}}
+        <details class="mb-4">
+            <summary class="text-lg font-medium cursor-pointer">🧹 Doc Comment Findings</summary>
+            <ul class="list-disc ml-6">
+                {{range .ProjectOverview.DocFindings}}
+                <li><a class="text-blue-600" href="{{sourceURL .Position}}">{{.Position}}</a>: {{.Kind}} <code>{{.Name}}</code>: {{.Message}}</li>
+                {{end}}
+            </ul>
+        </details>
+        {{end}}
+        {{if .ProjectOverview.DataRaces}}
+        <h3 class="text-lg font-medium mb-2">🏁 Data Races</h3>
+        {{range .ProjectOverview.DataRaces}}
+        <details class="mb-4">
+            <summary class="cursor-pointer">{{.Package}} <code>{{if .Test}}{{.Test}}{{else}}outside any test{{end}}</code>{{if gt .Count 1}} (reported {{.Count}} times){{end}}{{range $i, $f := .Functions}}{{if $i}},{{else}}:{{end}} <a class="text-blue-600" href="{{sourceURL $f.Position}}"><code>{{$f.Name}}</code></a>{{end}}</summary>
+            <pre class="bg-gray-100 p-2 overflow-x-auto"><code>{{.Stacks}}</code></pre>
+        </details>
+        {{end}}
+        {{end}}
+        {{if .ProjectOverview.RuleViolations}}
+        <h3 class="text-lg font-medium mb-2">🚧 Architecture Rule Violations</h3>
+        <ul class="list-disc ml-6 mb-4">
+            {{range .ProjectOverview.RuleViolations}}
+            <li><a class="text-blue-600" href="{{sourceURL .Position}}">{{.Position}}</a>: {{.Message}} (rule: {{.Rule}})</li>
+            {{end}}
+        </ul>
+        {{end}}
+        {{if .ProjectOverview.Excluded}}
+        <details class="mb-4">
+            <summary class="text-lg font-medium cursor-pointer">🙈 Excluded Paths</summary>
+            <ul class="list-disc ml-6">
+                {{range .ProjectOverview.Excluded}}
+                <li><code>{{.Path}}</code>: {{.Reason}}</li>
+                {{end}}
+            </ul>
+        </details>
+        {{end}}
+        {{if .ProjectOverview.TypeErrors}}
+        <p class="mb-4">⚠️ Type checking reported {{.ProjectOverview.TypeErrors}} errors; resolved types may be incomplete.</p>
+        {{end}}
+        {{end}}
+        {{range .Summaries}}
+        <details class="mb-4 bg-white rounded-lg shadow">
+            <summary class="p-4 text-xl font-semibold cursor-pointer">📂 {{.Filename}} ({{.Package}})</summary>
+            <div class="p-4">
+                <h3 class="text-lg font-medium">📈 Metrics</h3>
+                <ul class="list-disc ml-6 mb-4">
+                    <li>📦 Import Path: {{.ImportPath}}</li>
+                    {{if .Generated}}<li>🤖 Generated: yes</li>{{end}}
+                    <li>📏 Lines of Code: {{.Lines}}</li>
+                    <li>🧾 Source / Comment / Blank / Mixed Lines: {{.SourceLines}} / {{.CommentLines}} / {{.BlankLines}} / {{.MixedLines}}</li>
+                    <li>🛠️ Number of Functions: {{len .Functions}}</li>
+                    <li>📏 Largest Function: {{.MaxFuncLines}} lines</li>
+                    <li>⚠️ Long Functions (>50 lines): {{len .LongFunctions}}</li>
+                    <li>📜 Comment-to-Code Ratio: {{printf "%.2f" .CommentRatio}}%</li>
+                    <li>🧠 Average Function Complexity: {{printf "%.2f" .AvgComplexity}}</li>
+                    <li>🧩 Average Cognitive Complexity: {{printf "%.2f" .AvgCognitive}}</li>
+                    <li>📖 Godoc Coverage: {{printf "%.2f" .GodocCoverage}}% ({{.DocumentedItems}} of {{.DocumentableItems}} items)</li>
+                    {{if .HasCoverage}}
+                    <li>🎯 Test Coverage: {{printf "%.2f" .TestCoverage}}% ({{.CoveredStatements}} of {{.Statements}} statements)</li>
+                    {{end}}
+                    <li>🔲 Max Function Depth: {{.MaxFunctionDepth}}</li>
+                    <li>🛡️ Maintainability Index: {{printf "%.2f" .MaintainabilityIdx}}</li>
+                    <li>🧮 Halstead Volume / Difficulty / Effort: {{printf "%.2f" .Halstead.Volume}} / {{printf "%.2f" .Halstead.Difficulty}} / {{printf "%.2f" .Halstead.Effort}}</li>
+                    <li>🔗 External Dependencies: {{.ExternalImportCount}}</li>
+                </ul>
+                {{if .Types}}
+                <h3 class="text-lg font-medium">🏗️ Types</h3>
+                {{range .Types}}
+                {{if .Comment}}
+                <p class="mb-2">{{.Comment}}</p>
+                {{end}}
+                <pre><code>{{.Definition}}</code></pre>
+                <p class="mb-2">📍 <a class="text-blue-600" href="{{sourceURL .Position}}">{{.Position}}</a></p>
+                {{if .Implements}}
+                <p class="mb-2">🧩 Implements: {{range $i, $iface := .Implements}}{{if $i}}, {{end}}<code>{{$iface}}</code>{{end}}</p>
+                {{end}}
+                {{if .Methods}}
+                <p class="mb-2">🔧 Methods: {{.MethodCount}}, total complexity {{.MethodComplexity}}</p>
+                <table class="table-auto mb-4">
+                    <thead>
+                        <tr><th class="px-2">Method</th><th class="px-2">Receiver</th><th class="px-2">Cyclomatic</th><th class="px-2">Cognitive</th></tr>
+                    </thead>
+                    <tbody>
+                        {{range .Methods}}
+                        <tr><td class="px-2"><a class="text-blue-600" href="{{sourceURL .Position}}">{{.Name}}</a></td><td class="px-2">{{if .Pointer}}pointer{{else}}value{{end}}</td><td class="px-2">{{.Complexity}}</td><td class="px-2">{{.Cognitive}}</td></tr>
+                        {{end}}
+                    </tbody>
+                </table>
+                {{end}}
+                {{end}}
+                {{end}}
+                {{if .Functions}}
+                <h3 class="text-lg font-medium mt-4">📋 Function Metrics</h3>
+                <table class="table-auto mb-4">
+                    <thead>
+                        <tr><th class="px-2">Function</th><th class="px-2">Lines</th><th class="px-2">SLOC</th><th class="px-2">Cyclomatic</th><th class="px-2">Cognitive</th><th class="px-2">Depth</th><th class="px-2">Halstead Volume</th><th class="px-2">Maintainability</th><th class="px-2">Coverage</th><th class="px-2">CRAP</th></tr>
+                    </thead>
+                    <tbody>
+                        {{$hasCoverage := .HasCoverage}}
+                        {{range .Functions}}
+                        <tr><td class="px-2"><a class="text-blue-600" href="{{sourceURL .Position}}">{{.Name}}</a></td><td class="px-2">{{.LineCount}}</td><td class="px-2">{{.SourceLines}}</td><td class="px-2">{{.Complexity}}</td><td class="px-2">{{.Cognitive}}</td><td class="px-2">{{.MaxDepth}}</td><td class="px-2">{{printf "%.2f" .Halstead.Volume}}</td><td class="px-2">{{printf "%.2f" .Maintainability}}</td>{{if $hasCoverage}}<td class="px-2">{{printf "%.2f" .Coverage}}%</td><td class="px-2">{{printf "%.2f" .CRAP}}</td>{{else}}<td class="px-2">-</td><td class="px-2">-</td>{{end}}</tr>
+                        {{end}}
+                    </tbody>
+                </table>
+                <h3 class="text-lg font-medium mt-4">🛠️ Functions</h3>
+                {{range .Functions}}
+                {{if .Comment}}
+                <p class="mb-2">{{.Comment}}</p>
+                {{end}}
+                <pre><code>{{.Signature}}</code></pre>
+                <p class="mb-2">📍 <a class="text-blue-600" href="{{sourceURL .Position}}">{{.Position}}</a></p>
+                {{end}}
+                {{end}}
+            </div>
+        </details>
+        {{end}}
+    </div>
+</body>
+</html>`
+
+	type TemplateData struct {
+		Summaries []struct {
+			CodeSummary
+			MaxFuncLines int
+			CommentRatio float64
+		}
+		ProjectOverview
+	}
+
+	data := TemplateData{ProjectOverview: overview}
+	for _, s := range summaries {
+		commentRatio := commentPercent(s.CommentLines, s.SourceLines)
+		maxFuncLines := 0
+		for _, f := range s.Functions {
+			if f.LineCount > maxFuncLines {
+				maxFuncLines = f.LineCount
+			}
+		}
+		data.Summaries = append(data.Summaries, struct {
+			CodeSummary
+			MaxFuncLines int
+			CommentRatio float64
+		}{
+			CodeSummary:  s,
+			MaxFuncLines: maxFuncLines,
+			CommentRatio: commentRatio,
+		})
+	}
+
+	tmpl, err := template.New("summary").Funcs(template.FuncMap{"sourceURL": linker.URL}).Parse(htmlTemplate)
+	if err != nil {
+		return fmt.Errorf("parsing HTML template: %w", err)
+	}
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("creating HTML file: %w", err)
+	}
+	defer f.Close()
+
+	if err := tmpl.Execute(f, data); err != nil {
+		return fmt.Errorf("executing HTML template: %w", err)
+	}
+	return nil
+}
+
+// relativeImportPath returns importPath relative to module, "." for the module's root package.
+// Without a module, import paths are already relative to the analyzed directory.
+func relativeImportPath(importPath, module string) string {
+	switch {
+	case module == "":
+		return importPath
+	case importPath == module:
+		return "."
+	}
+	return strings.TrimPrefix(importPath, module+"/")
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// computeProjectOverview aggregates project-wide metrics.
+// Generated files count towards the file, line and package totals but are left out of the
+// health, effort and risk calculations unless includeGenerated is set.
+func computeProjectOverview(summaries []CodeSummary, includeGenerated bool) ProjectOverview {
+	overview := ProjectOverview{PackageMetrics: make(map[string]PackageMetric), ImportGraph: make(map[string][]string), IncludeGenerated: includeGenerated}
+	var totalCommentRatio, totalComplexity, totalCognitive, totalMaintainability float64
+	var scoredFiles, scoredLines int
+	packageDocs := make(map[string]bool)
+	importClasses := make(map[string]string)
+	modules := make(map[string]*ExternalModule)
+	packageKeys := make(map[string]string)
+	implementers := make(map[string][]string)
+
+	for _, s := range summaries {
+		overview.TotalFiles++
+		overview.TotalLines += s.Lines
+		overview.TotalSourceLines += s.SourceLines
+		overview.TotalCommentLines += s.CommentLines
+		overview.TotalBlankLines += s.BlankLines
+		if s.Generated {
+			overview.GeneratedFiles++
+			overview.GeneratedLines += s.Lines
+		} else {
+			overview.HandwrittenLines += s.Lines
+		}
+		overview.TypeErrors += s.TypeErrors
+		for _, t := range s.Types {
+			for _, iface := range t.Implements {
+				implementers[iface] = append(implementers[iface], s.ImportPath+"."+t.Name)
+			}
+		}
+
+		// Package metrics
+		key := relativeImportPath(s.ImportPath, s.Module)
+		packageKeys[s.ImportPath] = key
+		pkgMetric := overview.PackageMetrics[key]
+		pkgMetric.Package = s.Package
+		pkgMetric.ImportPath = s.ImportPath
+		pkgMetric.FileCount++
+		pkgMetric.LineCount += s.Lines
+		pkgMetric.SourceLines += s.SourceLines
+		pkgMetric.CommentLines += s.CommentLines
+		pkgMetric.BlankLines += s.BlankLines
+		pkgMetric.MixedLines += s.MixedLines
+		pkgMetric.ImportCount += len(s.Imports)
+		pkgMetric.Statements += s.Statements
+		pkgMetric.CoveredStatements += s.CoveredStatements
+		for _, t := range s.Types {
+			pkgMetric.TypeCount++
+			if t.Kind == "interface" {
+				pkgMetric.InterfaceCount++
+			}
+		}
+		overview.PackageMetrics[key] = pkgMetric
+
+		// Dependencies
+		for _, imp := range s.ImportLines {
+			importClasses[imp.Path] = imp.Class
+			if !containsString(overview.ImportGraph[s.ImportPath], imp.Path) {
+				overview.ImportGraph[s.ImportPath] = append(overview.ImportGraph[s.ImportPath], imp.Path)
+			}
+			if imp.Class != importExternal {
+				continue
+			}
+			module, ok := modules[imp.Module]
+			if !ok {
+				module = &ExternalModule{Path: imp.Module, Version: imp.Version, Requirement: imp.Requirement}
+				modules[imp.Module] = module
+			}
+			if !containsString(module.Imports, imp.Path) {
+				module.Imports = append(module.Imports, imp.Path)
+			}
+			if !containsString(module.UsedBy, s.ImportPath) {
+				module.UsedBy = append(module.UsedBy, s.ImportPath)
+			}
+		}
+
+		if s.Generated && !includeGenerated {
+			continue
+		}
+		scoredFiles++
+		scoredLines += s.SourceLines
+		overview.TotalFunctions += len(s.Functions)
+		overview.TotalLongFuncs += len(s.LongFunctions)
+		totalCommentRatio += commentPercent(s.CommentLines, s.SourceLines)
+		totalComplexity += s.AvgComplexity
+		totalCognitive += s.AvgCognitive
+		totalMaintainability += s.MaintainabilityIdx
+		overview.DocumentedItems += s.DocumentedItems
+		overview.DocumentableItems += s.DocumentableItems
+		overview.Undocumented = append(overview.Undocumented, s.Undocumented...)
+		overview.DocFindings = append(overview.DocFindings, s.DocFindings...)
+		packageDocs[s.ImportPath] = packageDocs[s.ImportPath] || s.PackageDoc
+
+		// Risky files
+		if s.AvgComplexity > 5 || s.GodocCoverage < 50 || len(s.LongFunctions) > 3 {
+			overview.RiskyFiles++
+		}
+	}
+
+	overview.PackageCount = len(overview.PackageMetrics)
+	for _, class := range importClasses {
+		switch class {
+		case importStdlib:
+			overview.StdlibImports++
+		case importInternal:
+			overview.InternalImports++
+		case importExternal:
+			overview.ExternalImports++
+		}
+	}
+	for _, module := range modules {
+		sort.Strings(module.Imports)
+		sort.Strings(module.UsedBy)
+		overview.ExternalModules = append(overview.ExternalModules, *module)
+	}
+	sort.Slice(overview.ExternalModules, func(i, j int) bool {
+		return overview.ExternalModules[i].Path < overview.ExternalModules[j].Path
+	})
+	overview.DependencyCount = len(overview.ExternalModules)
+	if scoredFiles > 0 {
+		overview.AvgCommentRatio = totalCommentRatio / float64(scoredFiles)
+		overview.AvgComplexity = totalComplexity / float64(scoredFiles)
+		overview.AvgCognitive = totalCognitive / float64(scoredFiles)
+		overview.AvgMaintainability = totalMaintainability / float64(scoredFiles)
+	}
+
+	// Doc coverage is weighted by item, with one package clause item per package.
+	for importPath, documented := range packageDocs {
+		overview.DocumentableItems++
+		if documented {
+			overview.DocumentedItems++
+		} else {
+			overview.UndocumentedPkgs = append(overview.UndocumentedPkgs, importPath)
+		}
+	}
+	sort.Strings(overview.UndocumentedPkgs)
+	if overview.DocumentableItems > 0 {
+		overview.GodocCoverage = float64(overview.DocumentedItems) / float64(overview.DocumentableItems) * 100
+	}
+
+	// Project Health Score
+	if scoredFiles > 0 {
+		health := math.Min(overview.AvgCommentRatio, 100)/100*30 +
+			overview.GodocCoverage/100*30 +
+			(1-float64(overview.TotalLongFuncs)/float64(overview.TotalFunctions+1))*20 +
+			(10-overview.AvgComplexity)/10*20
+		overview.ProjectHealth = health
+		if overview.ProjectHealth > 100 {
+			overview.ProjectHealth = 100
+		}
+		if overview.ProjectHealth < 0 {
+			overview.ProjectHealth = 0
+		}
+	}
+
+	// Effort estimate
+	overview.EffortHours = float64(scoredLines)/100*0.5 +
+		overview.AvgComplexity*float64(overview.TotalFunctions)*0.2 +
+		float64(overview.TotalLongFuncs)*5
+
+	for _, imports := range overview.ImportGraph {
+		sort.Strings(imports)
+	}
+
+	// Package coupling over the edges between analyzed packages. Without a module path the
+	// packages are keyed by directory, which no import path can match.
+	coupling := false
+	for _, s := range summaries {
+		coupling = coupling || s.Module != ""
+	}
+	if !coupling {
+		overview.CouplingNote = "no go.mod, so imports cannot be matched to the analyzed packages"
+	}
+	for from, imports := range overview.ImportGraph {
+		for _, imp := range imports {
+			to, ok := packageKeys[imp]
+			if !ok || imp == from {
+				continue
+			}
+			fromMetric := overview.PackageMetrics[packageKeys[from]]
+			fromMetric.Efferent++
+			overview.PackageMetrics[packageKeys[from]] = fromMetric
+			toMetric := overview.PackageMetrics[to]
+			toMetric.Afferent++
+			overview.PackageMetrics[to] = toMetric
+		}
+	}
+	for pkg, metric := range overview.PackageMetrics {
+		metric.CouplingCount = metric.Afferent + metric.Efferent
+		if metric.Afferent+metric.Efferent > 0 {
+			metric.Instability = float64(metric.Efferent) / float64(metric.Afferent+metric.Efferent)
+		}
+		if metric.Statements > 0 {
+			metric.Coverage = statementPercent(metric.CoveredStatements, metric.Statements)
+		}
+		if metric.TypeCount > 0 {
+			metric.Abstractness = float64(metric.InterfaceCount) / float64(metric.TypeCount)
+		}
+		metric.Distance = math.Abs(metric.Abstractness + metric.Instability - 1)
+		switch {
+		case !coupling:
+			metric.Distance, metric.Zone = 0, zoneUnknown
+		case metric.Afferent+metric.Efferent == 0:
+			// Neither importing nor imported, so there is no position on the main sequence to rank
+			metric.Distance, metric.Zone = 0, zoneIsolated
+		case metric.Distance <= mainSequenceTolerance:
+			metric.Zone = zoneMainSequence
+		case metric.Abstractness+metric.Instability < 1:
+			metric.Zone = zonePain
+		default:
+			metric.Zone = zoneUselessness
+		}
+		overview.PackageMetrics[pkg] = metric
+	}
+
+	// Interface implementations, only present after the type-checked pass
+	for iface, names := range implementers {
+		sort.Strings(names)
+		overview.Implementations = append(overview.Implementations, InterfaceImpl{Interface: iface, Implementers: names})
+	}
+	sort.Slice(overview.Implementations, func(i, j int) bool {
+		return overview.Implementations[i].Interface < overview.Implementations[j].Interface
+	})
+
+	// Functions ranked by CRAP score, only present with a cover profile
+	overview.HighestRisk = highestRisk(summaries, includeGenerated)
+
+	return overview
+}
+
+// generateJSON writes the JSON summary.
+func generateJSON(summaries []CodeSummary, overview ProjectOverview, outputPath string) error {
+	type JSONSummary struct {
+		Filename           string          `json:"filename"`
+		Package            string          `json:"package"`
+		ImportPath         string          `json:"import_path"`
+		Module             string          `json:"module"`
+		Generated          bool            `json:"generated"`
+		Types              []TypeDecl      `json:"types"`
+		Functions          []FuncDecl      `json:"functions"`
+		Imports            []string        `json:"imports"`
+		Lines              int             `json:"lines"`
+		SourceLines        int             `json:"source_lines"`
+		CommentLines       int             `json:"comment_lines"`
+		BlankLines         int             `json:"blank_lines"`
+		MixedLines         int             `json:"mixed_lines"`
+		MaxFuncLines       int             `json:"largest_function_lines"`
+		CommentRatio       float64         `json:"comment_ratio"`
+		LongFunctions      []FuncDecl      `json:"long_functions"`
+		AvgComplexity      float64         `json:"avg_complexity"`
+		AvgCognitive       float64         `json:"avg_cognitive_complexity"`
+		GodocCoverage      float64         `json:"godoc_coverage"`
+		DocumentedItems    int             `json:"documented_items"`
+		DocumentableItems  int             `json:"documentable_items"`
+		Undocumented       []DocItem       `json:"undocumented"`
+		DocFindings        []DocFinding    `json:"doc_findings"`
+		HasCoverage        bool            `json:"has_coverage"`
+		Statements         int             `json:"statements"`
+		CoveredStatements  int             `json:"covered_statements"`
+		TestCoverage       float64         `json:"test_coverage"`
+		MaxFunctionDepth   int             `json:"max_function_depth"`
+		MaintainabilityIdx float64         `json:"maintainability_index"`
+		Halstead           HalsteadMetrics `json:"halstead"`
+	}
+
+	type JSONOutput struct {
+		Overview ProjectOverview `json:"overview"`
+		Files    []JSONSummary   `json:"files"`
+	}
+
+	var jsonData JSONOutput
+	jsonData.Overview = overview
+	for _, s := range summaries {
+		commentRatio := commentPercent(s.CommentLines, s.SourceLines)
+		maxFuncLines := 0
+		for _, f := range s.Functions {
+			if f.LineCount > maxFuncLines {
+				maxFuncLines = f.LineCount
+			}
+		}
+		jsonData.Files = append(jsonData.Files, JSONSummary{
+			Filename:           s.Filename,
+			Package:            s.Package,
+			ImportPath:         s.ImportPath,
+			Module:             s.Module,
+			Generated:          s.Generated,
+			Types:              s.Types,
+			Functions:          s.Functions,
+			Imports:            s.Imports,
+			Lines:              s.Lines,
+			SourceLines:        s.SourceLines,
+			CommentLines:       s.CommentLines,
+			BlankLines:         s.BlankLines,
+			MixedLines:         s.MixedLines,
+			MaxFuncLines:       maxFuncLines,
+			CommentRatio:       commentRatio,
+			LongFunctions:      s.LongFunctions,
+			AvgComplexity:      s.AvgComplexity,
+			AvgCognitive:       s.AvgCognitive,
+			GodocCoverage:      s.GodocCoverage,
+			DocumentedItems:    s.DocumentedItems,
+			DocumentableItems:  s.DocumentableItems,
+			Undocumented:       s.Undocumented,
+			DocFindings:        s.DocFindings,
+			HasCoverage:        s.HasCoverage,
+			Statements:         s.Statements,
+			CoveredStatements:  s.CoveredStatements,
+			TestCoverage:       s.TestCoverage,
+			MaxFunctionDepth:   s.MaxFunctionDepth,
+			MaintainabilityIdx: s.MaintainabilityIdx,
+			Halstead:           s.Halstead,
+		})
+	}
+
+	data, err := json.MarshalIndent(jsonData, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+	return os.WriteFile(outputPath, data, 0644)
+}
+
+// ruleConfig is the architecture rules file read by -rules. Package patterns are import
+// paths, absolute or relative to the module, in which "..." matches any string, so
+// "internal/..." matches internal and every package below it.
+type ruleConfig struct {
+	Rules []importRule `json:"rules"`
+	// DenyCycles reports every import cycle between analyzed packages.
+	DenyCycles bool `json:"deny_cycles"`
+	// FailOnViolation makes the run exit with status 1 when any rule is violated.
+	FailOnViolation bool `json:"fail_on_violation"`
+}
+
+// importRule forbids packages matching From to import packages matching any Deny pattern,
+// unless the import also matches an Allow pattern.
+type importRule struct {
+	Name  string   `json:"name"`
+	From  string   `json:"from"`
+	Deny  []string `json:"deny"`
+	Allow []string `json:"allow"`
+
+	from  *regexp.Regexp
+	deny  []*regexp.Regexp
+	allow []*regexp.Regexp
+}
+
+// RuleViolation is an import that breaks an architecture rule or closes an import cycle.
+// Position points at the offending import declaration.
+type RuleViolation struct {
+	Rule     string
+	Package  string
+	Import   string
+	Position Position
+	Message  string
+}
+
+// compileImportPattern turns a package pattern into a regular expression. Like go list, a
+// trailing "/..." also matches the directory itself.
+func compileImportPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty package pattern")
+	}
+	expr := regexp.QuoteMeta(pattern)
+	if strings.HasSuffix(expr, `/\.\.\.`) {
+		expr = strings.TrimSuffix(expr, `/\.\.\.`) + `(/.*)?`
+	}
+	expr = strings.ReplaceAll(expr, `\.\.\.`, `.*`)
+	return regexp.Compile("^" + expr + "$")
+}
+
+// loadRules reads and compiles the rules file at path.
+func loadRules(path string) (*ruleConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rules: %w", err)
+	}
+	var config ruleConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing rules %s: %w", path, err)
+	}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("%s must not import %s", rule.From, strings.Join(rule.Deny, ", "))
+		}
+		if rule.from, err = compileImportPattern(rule.From); err != nil {
+			return nil, fmt.Errorf("rule %q: from: %w", rule.Name, err)
+		}
+		for _, pattern := range rule.Deny {
+			re, err := compileImportPattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: deny: %w", rule.Name, err)
+			}
+			rule.deny = append(rule.deny, re)
+		}
+		for _, pattern := range rule.Allow {
+			re, err := compileImportPattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: allow: %w", rule.Name, err)
+			}
+			rule.allow = append(rule.allow, re)
+		}
+	}
+	return &config, nil
+}
+
+// matchesAny reports whether the import path, absolute or relative to module, matches one of patterns.
+func matchesAny(patterns []*regexp.Regexp, importPath, module string) bool {
+	rel := relativeImportPath(importPath, module)
+	for _, re := range patterns {
+		if re.MatchString(importPath) || re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRules checks every import of the analyzed files against config.
+func checkRules(summaries []CodeSummary, config *ruleConfig) []RuleViolation {
+	var violations []RuleViolation
+	for _, s := range summaries {
+		for _, imp := range s.ImportLines {
+			for _, rule := range config.Rules {
+				if !matchesAny([]*regexp.Regexp{rule.from}, s.ImportPath, s.Module) ||
+					!matchesAny(rule.deny, imp.Path, s.Module) || matchesAny(rule.allow, imp.Path, s.Module) {
+					continue
+				}
+				violations = append(violations, RuleViolation{
+					Rule:     rule.Name,
+					Package:  s.ImportPath,
+					Import:   imp.Path,
+					Position: imp.Position,
+					Message:  fmt.Sprintf("%s imports %s", s.ImportPath, imp.Path),
+				})
+			}
+		}
+	}
+	if config.DenyCycles {
+		violations = append(violations, importCycles(summaries)...)
+	}
+	return violations
+}
+
+// importCycles finds the strongly connected components of the import graph between analyzed
+// packages with Tarjan's algorithm and reports one violation per cycle, at the import that
+// leaves the cycle's first package.
+func importCycles(summaries []CodeSummary) []RuleViolation {
+	analyzed := make(map[string]bool)
+	for _, s := range summaries {
+		analyzed[s.ImportPath] = true
+	}
+	edges := make(map[string][]string)
+	importAt := make(map[[2]string]Position)
+	for _, s := range summaries {
+		for _, imp := range s.ImportLines {
+			if !analyzed[imp.Path] || imp.Path == s.ImportPath {
+				continue
+			}
+			edge := [2]string{s.ImportPath, imp.Path}
+			if _, seen := importAt[edge]; !seen {
+				importAt[edge] = imp.Position
+				edges[s.ImportPath] = append(edges[s.ImportPath], imp.Path)
+			}
+		}
+	}
+	nodes := make([]string, 0, len(analyzed))
+	for node := range analyzed {
+		nodes = append(nodes, node)
+		sort.Strings(edges[node])
+	}
+	sort.Strings(nodes)
+
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		index[v] = len(index)
+		lowlink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range edges[v] {
+			if _, visited := index[w]; !visited {
+				strongConnect(w)
+				lowlink[v] = min(lowlink[v], lowlink[w])
+			} else if onStack[w] {
+				lowlink[v] = min(lowlink[v], index[w])
+			}
+		}
+		if lowlink[v] == index[v] {
+			var component []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			if len(component) > 1 {
+				components = append(components, component)
+			}
+		}
+	}
+	for _, node := range nodes {
+		if _, visited := index[node]; !visited {
+			strongConnect(node)
+		}
+	}
+
+	var violations []RuleViolation
+	for _, component := range components {
+		sort.Strings(component)
+		inCycle := make(map[string]bool)
+		for _, node := range component {
+			inCycle[node] = true
+		}
+		// Walk from the first package along edges inside the component until a package repeats.
+		path := []string{component[0]}
+		seen := map[string]int{component[0]: 0}
+		for {
+			last := path[len(path)-1]
+			var next string
+			for _, w := range edges[last] {
+				if inCycle[w] {
+					next = w
+					break
+				}
+			}
+			if i, ok := seen[next]; ok {
+				path = append(path[i:], next)
+				break
+			}
+			seen[next] = len(path)
+			path = append(path, next)
+		}
+		violations = append(violations, RuleViolation{
+			Rule:     "no import cycles",
+			Package:  path[0],
+			Import:   path[1],
+			Position: importAt[[2]string{path[0], path[1]}],
+			Message:  "import cycle: " + strings.Join(path, " -> "),
+		})
+	}
+	return violations
+}
+
+// graphOptions controls how the import graph is drawn.
+type graphOptions struct {
+	ModulePath string
+	Depth      int
+	HideStdlib bool
+}
 
-// generateHTML writes the HTML summary with visualizations.
-func generateHTML(summaries []CodeSummary, testCoverage float64, outputPath string) error {
-	const htmlTemplate = `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Go Code Summary</title>
-    <script src="https://cdn.tailwindcss.com"></script>
-    <script src="https://cdn.jsdelivr.net/npm/chart.js"></script>
-    <style>
-        pre { background-color: #1f2937; color: #e5e7eb; padding: 1rem; border-radius: 0.5rem; }
-        code { font-family: monospace; }
-    </style>
-</head>
-<body class="bg-gray-100 font-sans">
-    <div class="container mx-auto p-4">
-        <h1 class="text-3xl font-bold mb-4">📝 Go Code Summary</h1>
-        <h2 class="text-2xl font-semibold mb-2">📊 Project Overview</h2>
-        {{if eq .ProjectOverview.TotalFiles 0}}
-        <p>No Go files found.</p>
-        {{else}}
-        <ul class="list-disc ml-6 mb-4">
-            <li>📂 Files Processed: {{.ProjectOverview.TotalFiles}}</li>
-            <li>📏 Total Lines of Code: {{.ProjectOverview.TotalLines}}</li>
-            <li>🛠️ Total Functions: {{.ProjectOverview.TotalFunctions}}</li>
-            <li>⚠️ Long Functions (>50 lines): {{.ProjectOverview.TotalLongFuncs}}</li>
-            <li>📜 Average Comment-to-Code Ratio: {{printf "%.2f" .ProjectOverview.AvgCommentRatio}}%</li>
-            <li>🧠 Average Function Complexity: {{printf "%.2f" .ProjectOverview.AvgComplexity}}</li>
-            <li>📖 Godoc Coverage: {{printf "%.2f" .ProjectOverview.GodocCoverage}}%</li>
-			<li>🎯 Total Test Coverage: {{printf "%.2f" .ProjectOverview.TestCoverage}}%</li>
-            <li>📦 Packages: {{.ProjectOverview.PackageCount}}</li>
-            <li>🔗 External Dependencies: {{.ProjectOverview.DependencyCount}}</li>
-            <li>🏥 Project Health Score: {{printf "%.2f" .ProjectOverview.ProjectHealth}}/100</li>
-            <li>🚨 Risky Files: {{.ProjectOverview.RiskyFiles}}</li>
-            <li>⏰ Estimated Refactoring Effort: {{printf "%.2f" .ProjectOverview.EffortHours}} hours</li>
-			{{range .Summaries}}
-				{{if .CodeSummary.Problems}}
-				<li> ⚡ Problems to address immediately</li>
-					📂 In File {{ .CodeSummary.Filename }}
-					<ul class="list-disc ml-6 mb-4">
-						{{range .CodeSummary.Problems}}
-							<li>❗Function {{.FunctionName}} Needs Refactoring as complexity is: {{.Complexity}} ( > 10) </li>
-						{{end}}
-					</ul>
-				{{end}}
-			{{end}}
-        </ul>
-        <h3 class="text-lg font-medium mb-2">📦 Package Breakdown</h3>
-        {{if .ProjectOverview.PackageMetrics}}
-        <canvas id="packageChart" class="mb-4"></canvas>
-        <script>
-            const ctx = document.getElementById('packageChart').getContext('2d');
-            new Chart(ctx, {
-                type: 'bar',
-                data: {
-                    labels: [{{range $pkg, $metric := .ProjectOverview.PackageMetrics}}'{{$pkg}}',{{end}}],
-                    datasets: [{
-                        label: 'File Count',
-                        data: [{{range $pkg, $metric := .ProjectOverview.PackageMetrics}}{{$metric.FileCount}},{{end}}],
-                        backgroundColor: '#3b82f6',
-                    }, {
-                        label: 'Line Count',
-                        data: [{{range $pkg, $metric := .ProjectOverview.PackageMetrics}}{{$metric.LineCount}},{{end}}],
-                        backgroundColor: '#10b981',
-                    }]
-                },
-                options: { scales: { y: { beginAtZero: true } } }
-            });
-        </script>
-        {{else}}
-        <p>No packages found.</p>
-        {{end}}
-        {{end}}
-        {{range .Summaries}}
-        <details class="mb-4 bg-white rounded-lg shadow">
-            <summary class="p-4 text-xl font-semibold cursor-pointer">📂 {{.Filename}} ({{.Package}})</summary>
-            <div class="p-4">
-                <h3 class="text-lg font-medium">📈 Metrics</h3>
-                <ul class="list-disc ml-6 mb-4">
-                    <li>📏 Lines of Code: {{.Lines}}</li>
-                    <li>🛠️ Number of Functions: {{len .Functions}}</li>
-                    <li>📏 Largest Function: {{.MaxFuncLines}} lines</li>
-                    <li>⚠️ Long Functions (>50 lines): {{len .LongFunctions}}</li>
-                    <li>📜 Comment-to-Code Ratio: {{printf "%.2f" .CommentRatio}}%</li>
-                    <li>🧠 Average Function Complexity: {{printf "%.2f" .AvgComplexity}}</li>
-                    <li>📖 Godoc Coverage: {{printf "%.2f" .GodocCoverage}}%</li>
-                    <li>🔲 Max Function Depth: {{.MaxFunctionDepth}}</li>
-                    <li>🛡️ Maintainability Index: {{printf "%.2f" .MaintainabilityIdx}}</li>
-                    <li>🔗 External Dependencies: {{len .Imports}}</li>
-                </ul>
-                {{if .Types}}
-                <h3 class="text-lg font-medium">🏗️ Types</h3>
-                {{range .Types}}
-                {{if .Comment}}
-                <p class="mb-2">{{.Comment}}</p>
-                {{end}}
-                <pre><code>{{.Definition}}</code></pre>
-                {{end}}
-                {{end}}
-                {{if .Functions}}
-                <h3 class="text-lg font-medium mt-4">🛠️ Functions</h3>
-                {{range .Functions}}
-                {{if .Comment}}
-                <p class="mb-2">{{.Comment}}</p>
-                {{end}}
-                <pre><code>{{.Signature}}</code></pre>
-                {{end}}
-                {{end}}
-            </div>
-        </details>
-        {{end}}
-    </div>
-</body>
-</html>`
+// dependencyGraph is the import graph after collapsing, with the health of every analyzed node.
+type dependencyGraph struct {
+	Nodes  []string
+	Health map[string]float64
+	Edges  [][2]string
+}
 
-	type TemplateData struct {
-		Summaries []struct {
-			CodeSummary
-			MaxFuncLines int
-			CommentRatio float64
+// isStdlib reports whether importPath belongs to the standard library, whose first path
+// element, unlike a module path's, contains no dot.
+func isStdlib(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// collapse shortens an analyzed package's import path to opts.Depth directories below the
+// module root. Other packages are left as they are. Without a module path, every path is taken
+// to be an analyzed package relative to the root.
+func (opts graphOptions) collapse(importPath string) string {
+	if opts.Depth <= 0 {
+		return importPath
+	}
+	prefix, rel := "", importPath
+	if opts.ModulePath != "" {
+		if !strings.HasPrefix(importPath, opts.ModulePath+"/") {
+			return importPath
+		}
+		prefix, rel = opts.ModulePath+"/", strings.TrimPrefix(importPath, opts.ModulePath+"/")
+	}
+	parts := strings.Split(rel, "/")
+	if len(parts) > opts.Depth {
+		parts = parts[:opts.Depth]
+	}
+	return prefix + strings.Join(parts, "/")
+}
+
+// buildDependencyGraph collapses the overview's import graph according to opts. The health
+// of a node is the project health score computed over the files it covers.
+func buildDependencyGraph(summaries []CodeSummary, overview ProjectOverview, opts graphOptions) dependencyGraph {
+	g := dependencyGraph{Health: make(map[string]float64)}
+	files := make(map[string][]CodeSummary)
+	analyzed := make(map[string]bool)
+	for _, s := range summaries {
+		analyzed[s.ImportPath] = true
+		node := opts.collapse(s.ImportPath)
+		files[node] = append(files[node], s)
+	}
+	nodes := make(map[string]bool)
+	for node, group := range files {
+		nodes[node] = true
+		// A package of generated files only is scored like handwritten code rather than as 0.
+		generatedOnly := true
+		for _, s := range group {
+			generatedOnly = generatedOnly && s.Generated
+		}
+		g.Health[node] = computeProjectOverview(group, generatedOnly).ProjectHealth
+	}
+
+	edges := make(map[[2]string]bool)
+	for from, imports := range overview.ImportGraph {
+		for _, imp := range imports {
+			internal := analyzed[imp]
+			if !internal && opts.HideStdlib && isStdlib(imp) {
+				continue
+			}
+			edge := [2]string{opts.collapse(from), imp}
+			if internal {
+				edge[1] = opts.collapse(imp)
+			}
+			if edge[0] == edge[1] {
+				continue
+			}
+			nodes[edge[1]] = true
+			edges[edge] = true
+		}
+	}
+
+	for node := range nodes {
+		g.Nodes = append(g.Nodes, node)
+	}
+	sort.Strings(g.Nodes)
+	for edge := range edges {
+		g.Edges = append(g.Edges, edge)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i][0] != g.Edges[j][0] {
+			return g.Edges[i][0] < g.Edges[j][0]
+		}
+		return g.Edges[i][1] < g.Edges[j][1]
+	})
+	return g
+}
+
+// healthClass buckets a health score the way the reports color it.
+func healthClass(health float64) string {
+	switch {
+	case health >= 80:
+		return "healthy"
+	case health >= 50:
+		return "warning"
+	default:
+		return "risky"
+	}
+}
+
+// graphColors are the fill colors of the health classes; packages outside the analysis are "external".
+var graphColors = map[string]string{
+	"healthy":  "#86efac",
+	"warning":  "#fde047",
+	"risky":    "#fca5a5",
+	"external": "#e5e7eb",
+}
+
+// writeDependencyGraphs writes the import graph as Graphviz DOT to dotPath and as a Mermaid
+// flowchart to mermaidPath. Analyzed packages are colored by health, others are grey.
+func writeDependencyGraphs(summaries []CodeSummary, overview ProjectOverview, opts graphOptions, dotPath, mermaidPath string) error {
+	g := buildDependencyGraph(summaries, overview, opts)
+	class := func(node string) string {
+		health, ok := g.Health[node]
+		if !ok {
+			return "external"
+		}
+		return healthClass(health)
+	}
+
+	var dot strings.Builder
+	dot.WriteString("digraph dependencies {\n")
+	dot.WriteString("\trankdir=LR;\n")
+	dot.WriteString("\tnode [shape=box, style=filled, fontname=\"Helvetica\"];\n")
+	for _, node := range g.Nodes {
+		label := strings.ReplaceAll(node, `"`, `\"`)
+		if health, ok := g.Health[node]; ok {
+			label += fmt.Sprintf(`\nhealth %.0f`, health)
+		}
+		dot.WriteString(fmt.Sprintf("\t%q [label=\"%s\", fillcolor=%q];\n", node, label, graphColors[class(node)]))
+	}
+	for _, edge := range g.Edges {
+		dot.WriteString(fmt.Sprintf("\t%q -> %q;\n", edge[0], edge[1]))
+	}
+	dot.WriteString("}\n")
+	if err := os.WriteFile(dotPath, []byte(dot.String()), 0644); err != nil {
+		return err
+	}
+
+	// Mermaid node IDs cannot contain slashes or dots, so nodes are numbered.
+	ids := make(map[string]string, len(g.Nodes))
+	var mermaid strings.Builder
+	mermaid.WriteString("flowchart LR\n")
+	for i, node := range g.Nodes {
+		ids[node] = fmt.Sprintf("n%d", i)
+		label := node
+		if health, ok := g.Health[node]; ok {
+			label = fmt.Sprintf("%s<br/>health %.0f", node, health)
+		}
+		mermaid.WriteString(fmt.Sprintf("    %s[\"%s\"]:::%s\n", ids[node], label, class(node)))
+	}
+	for _, edge := range g.Edges {
+		mermaid.WriteString(fmt.Sprintf("    %s --> %s\n", ids[edge[0]], ids[edge[1]]))
+	}
+	for _, name := range []string{"healthy", "warning", "risky", "external"} {
+		mermaid.WriteString(fmt.Sprintf("    classDef %s fill:%s\n", name, graphColors[name]))
+	}
+	return os.WriteFile(mermaidPath, []byte(mermaid.String()), 0644)
+}
+
+func main() {
+	packagesMode := flag.Bool("packages", false, "load the module's package set with `go list` (honors go.mod and build constraints) instead of walking the directory")
+	typesMode := flag.Bool("types", false, "run the type-checked pass: resolved types, method sets and interface implementations")
+	includeGenerated := flag.Bool("include-generated", false, "count generated files (\"// Code generated ... DO NOT EDIT.\") in the health, effort and risk scores")
+	var opts analysisOptions
+	flag.IntVar(&opts.MaxCyclomatic, "max-cyclomatic", 10, "flag functions whose cyclomatic complexity exceeds this value")
+	flag.IntVar(&opts.MaxCognitive, "max-cognitive", 15, "flag functions whose cognitive complexity exceeds this value")
+	flag.Float64Var(&opts.MaxCRAP, "max-crap", 30, "flag functions whose CRAP score (complexity weighted by missing test coverage) exceeds this value")
+	flag.StringVar(&opts.Maintainability, "mi", miVisualStudio, "maintainability index variant: vs (Visual Studio, 0-100), sei (adds the comment term) or legacy (the original ad-hoc score)")
+	repoURL := flag.String("repo-url", "", "link HTML report entries to a repository browser, e.g. https://github.com/org/repo/blob/main/{path}#L{line}-L{endline}")
+	graph := flag.Bool("graph", false, "also write the package import graph as Graphviz DOT (go_code_summary.dot) and Mermaid (go_code_summary.mmd)")
+	var graphOpts graphOptions
+	flag.IntVar(&graphOpts.Depth, "graph-depth", 0, "collapse the module's packages in the graph to this many directory levels below the module root (0 keeps every package)")
+	flag.BoolVar(&graphOpts.HideStdlib, "graph-hide-stdlib", false, "leave standard library packages out of the graph")
+	junit := flag.Bool("junit", false, "also write the test results as JUnit XML (go_code_summary.junit.xml)")
+	rulesPath := flag.String("rules", "", "check the import graph against the architecture rules in this JSON file")
+	minGodoc := flag.Float64("min-godoc", 0, "exit with status 1 after writing the reports if godoc coverage is below this percentage")
+	var includes, excludes stringList
+	flag.Var(&includes, "include", "only analyze files matching this glob (repeatable; ** matches any number of directories)")
+	flag.Var(&excludes, "exclude", "skip files and directories matching this glob (repeatable)")
+	var coverProfiles stringList
+	flag.Var(&coverProfiles, "coverprofile", "read test coverage from this existing Go cover profile instead of running the tests (repeatable; profiles are merged)")
+	var testOpts testOptions
+	flag.IntVar(&testOpts.Count, "count", 1, "run each test this many times to find flaky and slow tests")
+	flag.BoolVar(&testOpts.Race, "race", false, "run the tests with the race detector and report data races")
+	flag.Parse()
+	switch opts.Maintainability {
+	case miVisualStudio, miSEI, miLegacy:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown maintainability index variant %q (want vs, sei or legacy)\n", opts.Maintainability)
+		os.Exit(2)
+	}
+	if testOpts.Count < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -count must be at least 1, got %d\n", testOpts.Count)
+		os.Exit(2)
+	}
+	if (testOpts.Count > 1 || testOpts.Race) && len(coverProfiles) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: -count and -race run the tests, but -coverprofile reads existing profiles instead")
+		os.Exit(2)
+	}
+
+	rootDir := "."
+	if flag.NArg() > 0 {
+		rootDir = flag.Arg(0)
+	}
+
+	var rules *ruleConfig
+	if *rulesPath != "" {
+		var err error
+		if rules, err = loadRules(*rulesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	filter := newPathFilter(rootDir, includes, excludes)
+	var goFiles []sourceFile
+	var excluded []ExcludedPath
+	var err error
+	if *packagesMode {
+		goFiles, excluded, err = loadPackages(rootDir, filter)
+	} else {
+		goFiles, excluded, err = scanDirectory(rootDir, filter)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	mod := parseGoMod(rootDir)
+	modulePath := mod.Path
+	var summaries []CodeSummary
+	var testFiles []testFileSummary
+	for _, file := range goFiles {
+		if file.Test {
+			testFile, err := parseTestFile(file.Path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				continue
+			}
+			testFile.ImportPath = file.ImportPath
+			testFiles = append(testFiles, testFile)
+			continue
+		}
+		summary, err := parseFile(file.Path, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			continue
+		}
+		summary.ImportPath = file.ImportPath
+		summary.Module = modulePath
+		mod.classify(summary.ImportLines)
+		summaries = append(summaries, summary)
+	}
+
+	if len(summaries) == 0 {
+		fmt.Println("No Go files found.")
+		return
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].ImportPath != summaries[j].ImportPath {
+			return summaries[i].ImportPath < summaries[j].ImportPath
+		}
+		return summaries[i].Filename < summaries[j].Filename
+	})
+
+	groupMethods(summaries)
+	if *typesMode {
+		// The source importer runs go list through go/build, which only passes on the environment
+		os.Setenv("GOFLAGS", readOnlyGoFlags(rootDir))
+		analyzeTypes(summaries)
+	}
+
+	coverage := reportTestCoverage(rootDir, coverProfiles, testOpts)
+	applyCoverage(summaries, coverage.Blocks, opts.MaxCRAP)
+	linkDataRaces(summaries, coverage.Races)
+
+	overview := computeProjectOverview(summaries, *includeGenerated)
+	overview.TestCoverage, overview.CoverageStatus, overview.CoverageNote = coverage.Percent, coverage.Status, coverage.Note
+	overview.TestResults = coverage.Tests
+	overview.TestsPassed, overview.TestsFailed, overview.TestsSkipped = testTotals(coverage.Tests)
+	overview.FlakyTests, overview.SlowestTests = flakyAndSlowest(coverage.Tests)
+	if len(coverProfiles) == 0 {
+		// Recorded even when the run failed or reported nothing, so the report says what was asked for
+		overview.TestRuns, overview.RaceDetector = testOpts.Count, testOpts.Race
+	}
+	overview.DataRaces = coverage.Races
+	overview.Excluded = excluded
+	overview.TestInventory = buildTestInventory(summaries, testFiles)
+	if rules != nil {
+		overview.RuleViolations = checkRules(summaries, rules)
+	}
+
+	var errors []error
+	if err := generateMarkdown(summaries, overview, "go_code_summary.md"); err != nil {
+		errors = append(errors, fmt.Errorf("generating Markdown: %w", err))
+	}
+	if err := generateHTML(summaries, overview, sourceLinker{root: rootDir, pattern: *repoURL}, "go_code_summary.html"); err != nil {
+		errors = append(errors, fmt.Errorf("generating HTML: %w", err))
+	}
+	if err := generateJSON(summaries, overview, "go_code_summary.json"); err != nil {
+		errors = append(errors, fmt.Errorf("generating JSON: %w", err))
+	}
+
+	if len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Println("Generated go_code_summary.md, go_code_summary.html, and go_code_summary.json")
+
+	if *graph {
+		graphOpts.ModulePath = modulePath
+		if err := writeDependencyGraphs(summaries, overview, graphOpts, "go_code_summary.dot", "go_code_summary.mmd"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing dependency graph: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Generated go_code_summary.dot and go_code_summary.mmd")
+	}
+
+	if *junit {
+		if err := writeJUnit(overview.TestResults, "go_code_summary.junit.xml"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing JUnit report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Generated go_code_summary.junit.xml")
+	}
+
+	failed := false
+	if overview.GodocCoverage < *minGodoc {
+		fmt.Fprintf(os.Stderr, "Godoc coverage %.2f%% is below the required %.2f%%\n", overview.GodocCoverage, *minGodoc)
+		failed = true
+	}
+	if rules != nil && rules.FailOnViolation && len(overview.RuleViolations) > 0 {
+		for _, v := range overview.RuleViolations {
+			fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", v.Position, v.Message, v.Rule)
+		}
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Outcomes of collecting test coverage.
+const (
+	coverageMeasured = "measured"
+	coveragePartial  = "partial"
+	coverageSkipped  = "skipped"
+	coverageFailed   = "failed"
+)
+
+// coverageResult is the outcome of collecting test coverage: the statement coverage, the
+// merged profile blocks, the status (measured, partial, skipped or failed) and a note
+// explaining anything but a full measurement. Tests and Races are only set if the tests ran.
+type coverageResult struct {
+	Percent float64
+	Blocks  []coverBlock
+	Status  string
+	Note    string
+	Tests   []PackageTestResult
+	Races   []DataRace
+}
+
+// testOptions controls how the tests are run.
+type testOptions struct {
+	Count int
+	Race  bool
+}
+
+// DataRace is a data race the race detector reported while running Test of Package.
+// Accesses are the two conflicting memory accesses, the current one first, and Goroutines
+// the stacks that created their goroutines. Functions are the analyzed functions on the
+// access stacks. Count is how often the race was reported, e.g. once per run with -count.
+type DataRace struct {
+	Package    string
+	Test       string
+	Accesses   []RaceStack
+	Goroutines []RaceStack
+	Functions  []RaceFunction
+	Count      int
+}
+
+// RaceStack is a stack of a data race report under its header, e.g. "Write at 0xc000012345
+// by goroutine 7" or "Goroutine 7 (running) created at". Frames are innermost first.
+type RaceStack struct {
+	Header string
+	Frames []StackFrame
+}
+
+// StackFrame is a frame of a race detector stack, e.g. example.com/mod/pkg.(*T).Inc at
+// /src/pkg/t.go:12.
+type StackFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// RaceFunction is an analyzed function involved in a data race, at its declaration.
+type RaceFunction struct {
+	Name     string
+	Position Position
+}
+
+// Stacks formats the race's stacks the way the race detector prints them.
+func (r DataRace) Stacks() string {
+	var b strings.Builder
+	for _, stack := range append(append([]RaceStack(nil), r.Accesses...), r.Goroutines...) {
+		b.WriteString(stack.Header + ":\n")
+		for _, f := range stack.Frames {
+			b.WriteString(fmt.Sprintf("  %s()\n      %s:%d\n", f.Function, f.File, f.Line))
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Summary describes the race for the list of problems, e.g. "a data race in TestInc,
+// reported 3 times".
+func (r DataRace) Summary() string {
+	summary := "a data race"
+	if r.Test != "" {
+		summary += " in " + r.Test
+	}
+	if r.Count > 1 {
+		summary += fmt.Sprintf(", reported %d times", r.Count)
+	}
+	return summary
+}
+
+// accessFrames identifies the race by the frames of its accesses. Unlike the headers, which
+// name addresses and goroutine IDs, they stay the same when a test races again.
+func (r DataRace) accessFrames() string {
+	var b strings.Builder
+	for _, stack := range r.Accesses {
+		for _, f := range stack.Frames {
+			b.WriteString(fmt.Sprintf("%s %s:%d\n", f.Function, f.File, f.Line))
 		}
-		ProjectOverview
+		b.WriteString("\n")
 	}
+	return b.String()
+}
 
-	overview := computeProjectOverview(summaries)
-	data := TemplateData{ProjectOverview: overview}
-	data.ProjectOverview.TestCoverage = testCoverage
-	for _, s := range summaries {
-		commentRatio := 0.0
-		if s.Lines > 0 {
-			commentRatio = float64(s.CommentLines) / float64(s.Lines) * 100
+// addRace appends race unless a race with the same access frames is already listed, in which
+// case it only counts the repeat.
+func addRace(races []DataRace, race DataRace) []DataRace {
+	for i := range races {
+		if races[i].accessFrames() == race.accessFrames() {
+			races[i].Count += race.Count
+			return races
 		}
-		maxFuncLines := 0
-		for _, f := range s.Functions {
-			if f.LineCount > maxFuncLines {
-				maxFuncLines = f.LineCount
-			}
+	}
+	return append(races, race)
+}
+
+// Outcomes of a test or of a package's tests, as reported by go test -json.
+const (
+	testPass = "pass"
+	testFail = "fail"
+	testSkip = "skip"
+)
+
+// TestResult is the outcome of a single test, subtest, example or fuzz target over all runs.
+// Subtests are listed under their full name, e.g. "TestParse/empty". A test that failed any
+// run has failed, and is Flaky if it also passed one. Elapsed is the mean and P95 the 95th
+// percentile of the durations of the runs that passed or failed, in seconds. Output is the
+// output of the last failed run.
+type TestResult struct {
+	Name     string
+	Status   string
+	Runs     int
+	Failures int
+	Flaky    bool
+	Elapsed  float64
+	P95      float64
+	Output   string
+}
+
+// TestStat is a test of a package listed among the flaky or slowest tests.
+type TestStat struct {
+	Package string
+	TestResult
+}
+
+// slowestTests is the number of tests listed as the slowest.
+const slowestTests = 10
+
+// PackageTestResult is the outcome of running a package's tests. A package without test files
+// is skipped. Output holds the package's own output if it failed without a failing test, e.g.
+// because it did not build.
+type PackageTestResult struct {
+	Package string
+	Status  string
+	Elapsed float64
+	Passed  int
+	Failed  int
+	Skipped int
+	Flaky   int
+	Tests   []TestResult
+	Output  string
+}
+
+// raceDelimiter is the line that opens and closes a race detector report.
+const raceDelimiter = "=================="
+
+// testEvent is a line of go test -json output, see go doc cmd/test2json. Build output is
+// reported with ImportPath instead of Package, and a package that did not build names it in
+// FailedBuild.
+type testEvent struct {
+	Action      string
+	Package     string
+	Test        string
+	Elapsed     float64
+	Output      string
+	ImportPath  string
+	FailedBuild string
+}
+
+// reportTestCoverage collects the test coverage of the module at root. Given existing cover
+// profiles, it merges them and runs nothing. Otherwise it runs the tests of the module at
+// root as opts says without modifying it: go test runs with -mod=readonly (or -mod=vendor)
+// whatever GOFLAGS says, and the profile is written to a temporary directory that is removed
+// afterwards.
+func reportTestCoverage(root string, profiles []string, opts testOptions) coverageResult {
+	if len(profiles) > 0 {
+		_, blocks, err := readCoverProfiles(profiles)
+		if err != nil {
+			return coverageResult{Status: coverageFailed, Note: err.Error()}
 		}
-		data.Summaries = append(data.Summaries, struct {
-			CodeSummary
-			MaxFuncLines int
-			CommentRatio float64
-		}{
-			CodeSummary:  s,
-			MaxFuncLines: maxFuncLines,
-			CommentRatio: commentRatio,
-		})
+		return coverageResult{Percent: coveragePercent(blocks), Blocks: blocks, Status: coverageMeasured}
+	}
+	if _, err := os.Stat(filepath.Join(root, "go.mod")); err != nil {
+		return coverageResult{Status: coverageSkipped, Note: "no go.mod in the analyzed directory"}
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		return coverageResult{Status: coverageSkipped, Note: "the go command is not on PATH"}
 	}
 
-	tmpl, err := template.New("summary").Parse(htmlTemplate)
+	dir, err := os.MkdirTemp("", "go-code-summary-")
 	if err != nil {
-		return fmt.Errorf("parsing HTML template: %w", err)
+		return coverageResult{Status: coverageSkipped, Note: fmt.Sprintf("creating a directory for the profile: %v", err)}
 	}
+	defer os.RemoveAll(dir)
+	profile := filepath.Join(dir, "coverage.out")
 
-	f, err := os.Create(outputPath)
+	tests, races, testErr := runTests(root, profile, opts)
+	if _, err := os.Stat(profile); err != nil {
+		return coverageResult{Status: coverageFailed, Note: fmt.Sprintf("go test wrote no coverage profile: %v", testErr), Tests: tests, Races: races}
+	}
+	_, blocks, err := readCoverProfiles([]string{profile})
 	if err != nil {
-		return fmt.Errorf("creating HTML file: %w", err)
+		return coverageResult{Status: coverageFailed, Note: err.Error(), Tests: tests, Races: races}
 	}
-	defer f.Close()
 
-	if err := tmpl.Execute(f, data); err != nil {
-		return fmt.Errorf("executing HTML template: %w", err)
+	var failed []string
+	for _, pkg := range tests {
+		if pkg.Status == testFail {
+			failed = append(failed, pkg.Package)
+		}
 	}
-	return nil
+	result := coverageResult{Percent: coveragePercent(blocks), Blocks: blocks, Status: coverageMeasured, Tests: tests, Races: races}
+	switch {
+	case len(failed) > 0:
+		result.Status, result.Note = coveragePartial, fmt.Sprintf("tests failed or did not build in %s", strings.Join(failed, ", "))
+	case testErr != nil:
+		result.Status, result.Note = coveragePartial, testErr.Error()
+	}
+	return result
 }
 
-// computeProjectOverview aggregates project-wide metrics.
-func computeProjectOverview(summaries []CodeSummary) ProjectOverview {
-	overview := ProjectOverview{PackageMetrics: make(map[string]PackageMetric)}
-	var totalCommentRatio, totalComplexity, totalGodoc float64
-	uniqueDeps := make(map[string]bool)
-	packageCoupling := make(map[string]map[string]bool)
+// crapScore is the Change Risk Anti-Patterns score of a function with the given cyclomatic
+// complexity and statement coverage in percent: comp² · (1 − cov)³ + comp.
+func crapScore(complexity int, coverage float64) float64 {
+	comp := float64(complexity)
+	return comp*comp*math.Pow(1-coverage/100, 3) + comp
+}
+
+// RiskFunction is a function listed among the highest risk functions by CRAP score.
+type RiskFunction struct {
+	Package    string
+	Function   string
+	Position   Position
+	Complexity int
+	Coverage   float64
+	CRAP       float64
+}
 
+// highestRiskFunctions is the number of functions listed as the highest risk.
+const highestRiskFunctions = 10
+
+// highestRisk returns the functions with the highest CRAP scores in the files present in the
+// cover profile. Generated files are skipped unless includeGenerated is set.
+func highestRisk(summaries []CodeSummary, includeGenerated bool) []RiskFunction {
+	var all []RiskFunction
 	for _, s := range summaries {
-		overview.TotalFiles++
-		overview.TotalLines += s.Lines
-		overview.TotalFunctions += len(s.Functions)
-		overview.TotalLongFuncs += len(s.LongFunctions)
-		if s.Lines > 0 {
-			totalCommentRatio += float64(s.CommentLines) / float64(s.Lines) * 100
+		if !s.HasCoverage || (s.Generated && !includeGenerated) {
+			continue
 		}
-		totalComplexity += s.AvgComplexity
-		totalGodoc += s.GodocCoverage
+		for _, f := range s.Functions {
+			all = append(all, RiskFunction{Package: s.ImportPath, Function: f.Name, Position: f.Position, Complexity: f.Complexity, Coverage: f.Coverage, CRAP: f.CRAP})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].CRAP > all[j].CRAP
+	})
+	if len(all) > highestRiskFunctions {
+		all = all[:highestRiskFunctions]
+	}
+	return all
+}
 
-		// Package metrics
-		pkgMetric := overview.PackageMetrics[s.Package]
-		pkgMetric.FileCount++
-		pkgMetric.LineCount += s.Lines
-		pkgMetric.ImportCount += len(s.Imports)
-		overview.PackageMetrics[s.Package] = pkgMetric
-
-		// Dependencies and coupling
-		for _, imp := range s.Imports {
-			uniqueDeps[imp] = true
-			for _, otherSum := range summaries {
-				if otherSum.Package == imp {
-					if _, exists := packageCoupling[s.Package]; !exists {
-						packageCoupling[s.Package] = make(map[string]bool)
+// applyCoverage maps the cover profile blocks onto the files and functions they belong to. A
+// block belongs to the function whose line range contains it, including function literals
+// inside it. Files absent from the profile are left without coverage; functions of files that
+// are present get a CRAP score and are added to the file's problems above maxCRAP.
+func applyCoverage(summaries []CodeSummary, blocks []coverBlock, maxCRAP float64) {
+	byFile := make(map[string][]coverBlock)
+	for _, b := range blocks {
+		byFile[b.File] = append(byFile[b.File], b)
+	}
+	for i := range summaries {
+		s := &summaries[i]
+		fileBlocks, ok := byFile[path.Join(s.ImportPath, filepath.Base(s.Filename))]
+		if !ok {
+			continue
+		}
+		s.HasCoverage = true
+		for _, b := range fileBlocks {
+			s.Statements += b.NumStmt
+			if b.Count > 0 {
+				s.CoveredStatements += b.NumStmt
+			}
+		}
+		s.TestCoverage = statementPercent(s.CoveredStatements, s.Statements)
+
+		crap := make(map[Position]FuncDecl)
+		for j := range s.Functions {
+			f := &s.Functions[j]
+			for _, b := range fileBlocks {
+				if b.StartLine >= f.Position.Line && b.EndLine <= f.Position.EndLine {
+					f.Statements += b.NumStmt
+					if b.Count > 0 {
+						f.CoveredStatements += b.NumStmt
 					}
-					packageCoupling[s.Package][imp] = true
 				}
 			}
+			f.Coverage = statementPercent(f.CoveredStatements, f.Statements)
+			f.CRAP = crapScore(f.Complexity, f.Coverage)
+			crap[f.Position] = *f
+			if f.CRAP > maxCRAP {
+				reason := fmt.Sprintf("CRAP score %.1f (> %.0f) at %.0f%% coverage", f.CRAP, maxCRAP, f.Coverage)
+				s.Problems = addProblem(s.Problems, *f, reason)
+			}
 		}
-
-		// Risky files
-		if s.AvgComplexity > 5 || s.GodocCoverage < 50 || len(s.LongFunctions) > 3 {
-			overview.RiskyFiles++
+		for j, f := range s.LongFunctions {
+			s.LongFunctions[j] = crap[f.Position]
 		}
 	}
+}
 
-	overview.PackageCount = len(overview.PackageMetrics)
-	overview.DependencyCount = len(uniqueDeps)
-	if overview.TotalFiles > 0 {
-		overview.AvgCommentRatio = totalCommentRatio / float64(overview.TotalFiles)
-		overview.AvgComplexity = totalComplexity / float64(overview.TotalFiles)
-		overview.GodocCoverage = totalGodoc / float64(overview.TotalFiles)
-	}
-
-	// Project Health Score
-	if overview.TotalFiles > 0 {
-		health := overview.AvgCommentRatio/100*30 +
-			overview.GodocCoverage/100*30 +
-			(1-float64(overview.TotalLongFuncs)/float64(overview.TotalFunctions+1))*20 +
-			(10-overview.AvgComplexity)/10*20
-		overview.ProjectHealth = health
-		if overview.ProjectHealth > 100 {
-			overview.ProjectHealth = 100
-		}
-		if overview.ProjectHealth < 0 {
-			overview.ProjectHealth = 0
+// addProblem adds reason to the problem entry of f, creating the entry if f has none.
+func addProblem(problems []ProblemFunction, f FuncDecl, reason string) []ProblemFunction {
+	for i := range problems {
+		if problems[i].Position == f.Position {
+			problems[i].Reason += ", " + reason
+			problems[i].CRAP = f.CRAP
+			return problems
 		}
 	}
+	return append(problems, ProblemFunction{
+		FunctionName:        f.Name,
+		Position:            f.Position,
+		Complexity:          int64(f.Complexity),
+		CognitiveComplexity: int64(f.Cognitive),
+		CRAP:                f.CRAP,
+		Reason:              reason,
+	})
+}
 
-	// Effort estimate
-	overview.EffortHours = float64(overview.TotalLines)/100*0.5 +
-		overview.AvgComplexity*float64(overview.TotalFunctions)*0.2 +
-		float64(overview.TotalLongFuncs)*5
+// statementPercent returns covered as a percentage of statements; a function without
+// statements has nothing left to cover.
+func statementPercent(covered, statements int) float64 {
+	if statements == 0 {
+		return 100
+	}
+	return float64(covered) / float64(statements) * 100
+}
 
-	// Package coupling
-	for pkg, metric := range overview.PackageMetrics {
-		metric.CouplingCount = len(packageCoupling[pkg])
-		overview.PackageMetrics[pkg] = metric
+// runTests runs go test -json with a coverage profile over every package of the module at
+// root, running each test opts.Count times and with the race detector if opts.Race is set. It
+// returns the results per package and the reported data races. On failure, the output of the
+// failed tests and packages is copied to stderr.
+func runTests(root, profile string, opts testOptions) ([]PackageTestResult, []DataRace, error) {
+	args := []string{"test", "-json", "-count=" + strconv.Itoa(opts.Count), "-coverprofile=" + profile}
+	if opts.Race {
+		args = append(args, "-race")
+	}
+	cmd := goCommand(root, append(args, "./...")...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	results, races := parseTestEvents(bytes.NewReader(output))
+	if err == nil {
+		return results, races, nil
 	}
 
-	return overview
+	os.Stderr.Write(stderr.Bytes())
+	for _, pkg := range results {
+		for _, t := range pkg.Tests {
+			os.Stderr.WriteString(t.Output)
+		}
+		os.Stderr.WriteString(pkg.Output)
+	}
+	return results, races, fmt.Errorf("go test: %w", err)
 }
 
-// generateJSON writes the JSON summary.
-func generateJSON(summaries []CodeSummary, testCoverage float64, outputPath string) error {
-	type JSONSummary struct {
-		Filename           string     `json:"filename"`
-		Package            string     `json:"package"`
-		Types              []TypeDecl `json:"types"`
-		Functions          []FuncDecl `json:"functions"`
-		Imports            []string   `json:"imports"`
-		Lines              int        `json:"lines"`
-		CommentLines       int        `json:"comment_lines"`
-		MaxFuncLines       int        `json:"largest_function_lines"`
-		CommentRatio       float64    `json:"comment_ratio"`
-		LongFunctions      []FuncDecl `json:"long_functions"`
-		AvgComplexity      float64    `json:"avg_complexity"`
-		GodocCoverage      float64    `json:"godoc_coverage"`
-		TestCoverage       float64    `json:"test_coverage"`
-		MaxFunctionDepth   int        `json:"max_function_depth"`
-		MaintainabilityIdx float64    `json:"maintainability_index"`
-	}
-
-	overview := computeProjectOverview(summaries)
-	type JSONOutput struct {
-		Overview ProjectOverview `json:"overview"`
-		Files    []JSONSummary   `json:"files"`
+// parseTestEvents reads the event stream of go test -json and returns the results per
+// package, sorted by package. With -count, a test is run again each time it reports "run"
+// after a result, and its runs are aggregated. Lines that are not JSON events are skipped,
+// except for the "FAIL pkg [setup failed]" lines go test prints for packages it could not
+// load. A run without a result, e.g. because its package panicked or timed out, has failed.
+// Race detector reports in the output are returned as data races, in the order they appear.
+func parseTestEvents(r io.Reader) ([]PackageTestResult, []DataRace) {
+	type testState struct {
+		result    TestResult
+		output    strings.Builder
+		running   bool
+		passed    int
+		durations []float64
 	}
-
-	var jsonData JSONOutput
-	jsonData.Overview = overview
-	for _, s := range summaries {
-		commentRatio := 0.0
-		if s.Lines > 0 {
-			commentRatio = float64(s.CommentLines) / float64(s.Lines) * 100
+	type packageState struct {
+		result   PackageTestResult
+		output   strings.Builder
+		tests    map[string]*testState
+		order    []*testState
+		inRace   bool
+		raceTest string
+		race     []string
+	}
+	packages := make(map[string]*packageState)
+	buildOutput := make(map[string]string)
+	var races []DataRace
+	raceLine := func(state *packageState, test, line string) {
+		switch {
+		case strings.HasPrefix(line, "WARNING: DATA RACE"):
+			state.inRace, state.raceTest, state.race = true, test, nil
+		case !state.inRace:
+		case strings.HasPrefix(line, raceDelimiter):
+			races = addRace(races, parseDataRace(state.result.Package, state.raceTest, state.race))
+			state.inRace = false
+		default:
+			state.race = append(state.race, strings.TrimRight(line, "\n"))
 		}
-		maxFuncLines := 0
-		for _, f := range s.Functions {
-			if f.LineCount > maxFuncLines {
-				maxFuncLines = f.LineCount
+	}
+	get := func(pkg string) *packageState {
+		state, ok := packages[pkg]
+		if !ok {
+			state = &packageState{result: PackageTestResult{Package: pkg}, tests: make(map[string]*testState)}
+			packages[pkg] = state
+		}
+		return state
+	}
+	test := func(state *packageState, name string) *testState {
+		t, ok := state.tests[name]
+		if !ok {
+			t = &testState{result: TestResult{Name: name}}
+			state.tests[name] = t
+			state.order = append(state.order, t)
+		}
+		return t
+	}
+	finish := func(t *testState, action string, elapsed float64) {
+		t.running = false
+		t.result.Runs++
+		switch action {
+		case testPass:
+			t.passed++
+		case testFail:
+			t.result.Failures++
+			t.result.Output = t.output.String()
+		case testSkip:
+			return
+		}
+		t.durations = append(t.durations, elapsed)
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			var event testEvent
+			if json.Unmarshal([]byte(line), &event) != nil {
+				if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "FAIL" {
+					state := get(fields[1])
+					state.result.Status = testFail
+					state.output.WriteString(line)
+				}
+			} else if event.Action == "build-output" {
+				buildOutput[event.ImportPath] += event.Output
+			} else if event.Package != "" {
+				state := get(event.Package)
+				switch {
+				case event.Test != "" && event.Action == "run":
+					t := test(state, event.Test)
+					t.output.Reset()
+					t.running = true
+				case event.Test != "" && event.Action == "output":
+					test(state, event.Test).output.WriteString(event.Output)
+					raceLine(state, event.Test, event.Output)
+				case event.Test != "" && (event.Action == testPass || event.Action == testFail || event.Action == testSkip):
+					finish(test(state, event.Test), event.Action, event.Elapsed)
+				case event.Test != "":
+					test(state, event.Test)
+				case event.Action == "output":
+					state.output.WriteString(event.Output)
+					raceLine(state, "", event.Output)
+				case event.Action == testPass || event.Action == testFail || event.Action == testSkip:
+					state.result.Status, state.result.Elapsed = event.Action, event.Elapsed
+					if event.FailedBuild != "" {
+						state.output.WriteString(buildOutput[event.FailedBuild])
+					}
+				}
 			}
 		}
-		jsonData.Files = append(jsonData.Files, JSONSummary{
-			Filename:           s.Filename,
-			Package:            s.Package,
-			Types:              s.Types,
-			Functions:          s.Functions,
-			Imports:            s.Imports,
-			Lines:              s.Lines,
-			CommentLines:       s.CommentLines,
-			MaxFuncLines:       maxFuncLines,
-			CommentRatio:       commentRatio,
-			LongFunctions:      s.LongFunctions,
-			AvgComplexity:      s.AvgComplexity,
-			GodocCoverage:      s.GodocCoverage,
-			TestCoverage:       testCoverage,
-			MaxFunctionDepth:   s.MaxFunctionDepth,
-			MaintainabilityIdx: s.MaintainabilityIdx,
-		})
+		if err != nil {
+			break
+		}
 	}
 
-	data, err := json.MarshalIndent(jsonData, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshaling JSON: %w", err)
+	results := make([]PackageTestResult, 0, len(packages))
+	for _, state := range packages {
+		result := state.result
+		if result.Status == "" {
+			result.Status = testFail
+		}
+		for _, t := range state.order {
+			if t.running || t.result.Runs == 0 {
+				finish(t, testFail, 0)
+			}
+			switch {
+			case t.result.Failures > 0:
+				t.result.Status = testFail
+				t.result.Flaky = t.passed > 0
+				result.Failed++
+			case t.passed > 0:
+				t.result.Status = testPass
+				result.Passed++
+			default:
+				t.result.Status = testSkip
+				result.Skipped++
+			}
+			if t.result.Flaky {
+				result.Flaky++
+			}
+			t.result.Elapsed, t.result.P95 = meanAndP95(t.durations)
+			result.Tests = append(result.Tests, t.result)
+		}
+		if result.Status == testFail && result.Failed == 0 {
+			result.Output = state.output.String()
+		}
+		results = append(results, result)
 	}
-	return os.WriteFile(outputPath, data, 0644)
+	sort.Slice(results, func(i, j int) bool { return results[i].Package < results[j].Package })
+	return results, races
 }
 
-func main() {
-	rootDir := "."
-	if len(os.Args) > 1 {
-		rootDir = os.Args[1]
+// parseDataRace parses the lines of a race detector report between "WARNING: DATA RACE" and
+// the closing delimiter. Every unindented line ending in ":" starts a stack, and each frame is
+// a function line followed by an indented "file:line +0x.." line.
+func parseDataRace(pkg, test string, lines []string) DataRace {
+	race := DataRace{Package: pkg, Test: test, Count: 1}
+	var stack *RaceStack
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case !strings.HasPrefix(line, " ") && strings.HasSuffix(trimmed, ":"):
+			header := strings.TrimSuffix(trimmed, ":")
+			if strings.HasPrefix(header, "Goroutine ") {
+				race.Goroutines = append(race.Goroutines, RaceStack{Header: header})
+				stack = &race.Goroutines[len(race.Goroutines)-1]
+			} else {
+				race.Accesses = append(race.Accesses, RaceStack{Header: header})
+				stack = &race.Accesses[len(race.Accesses)-1]
+			}
+		case stack == nil:
+		case strings.HasPrefix(line, "      ") && len(stack.Frames) > 0:
+			location, _, _ := strings.Cut(trimmed, " +0x")
+			if i := strings.LastIndex(location, ":"); i >= 0 {
+				frame := &stack.Frames[len(stack.Frames)-1]
+				frame.File = location[:i]
+				frame.Line, _ = strconv.Atoi(location[i+1:])
+			}
+		default:
+			stack.Frames = append(stack.Frames, StackFrame{Function: strings.TrimSuffix(trimmed, "()")})
+		}
 	}
+	return race
+}
 
-	goFiles, err := scanDirectory(rootDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+// linkDataRaces attaches to every race the analyzed functions whose line range contains a
+// frame of its access stacks. Paths are compared as absolute paths, since the race detector prints absolute file names.
+func linkDataRaces(summaries []CodeSummary, races []DataRace) {
+	absolute := func(name string) string {
+		if abs, err := filepath.Abs(name); err == nil {
+			return abs
+		}
+		return name
 	}
-
-	var summaries []CodeSummary
-	for _, file := range goFiles {
-		summary, err := parseFile(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
-			continue
+	byFile := make(map[string]int)
+	for i, s := range summaries {
+		byFile[absolute(s.Filename)] = i
+	}
+	for r := range races {
+		race := &races[r]
+		seen := make(map[Position]bool)
+		for _, stack := range race.Accesses {
+			for _, frame := range stack.Frames {
+				i, ok := byFile[absolute(frame.File)]
+				if !ok {
+					continue
+				}
+				for _, f := range summaries[i].Functions {
+					if frame.Line < f.Position.Line || frame.Line > f.Position.EndLine || seen[f.Position] {
+						continue
+					}
+					seen[f.Position] = true
+					race.Functions = append(race.Functions, RaceFunction{Name: f.Name, Position: f.Position})
+				}
+			}
 		}
-		summaries = append(summaries, summary)
 	}
+}
 
-	if len(summaries) == 0 {
-		fmt.Println("No Go files found.")
-		return
+// meanAndP95 returns the mean and the nearest-rank 95th percentile of the durations.
+func meanAndP95(durations []float64) (float64, float64) {
+	if len(durations) == 0 {
+		return 0, 0
 	}
-
-	sort.Slice(summaries, func(i, j int) bool {
-		return summaries[i].Filename < summaries[j].Filename
-	})
-
-	testCoverage := reportTestCoverage(rootDir)
-
-	var errors []error
-	if err := generateMarkdown(summaries, testCoverage, "go_code_summary.md"); err != nil {
-		errors = append(errors, fmt.Errorf("generating Markdown: %w", err))
+	sorted := append([]float64(nil), durations...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, d := range sorted {
+		sum += d
 	}
-	if err := generateHTML(summaries, testCoverage, "go_code_summary.html"); err != nil {
-		errors = append(errors, fmt.Errorf("generating HTML: %w", err))
+	rank := int(math.Ceil(0.95 * float64(len(sorted))))
+	return sum / float64(len(sorted)), sorted[rank-1]
+}
+
+// flakyAndSlowest lists the tests that both passed and failed, and the slowest tests by their
+// 95th percentile duration, ties broken by name.
+func flakyAndSlowest(results []PackageTestResult) ([]TestStat, []TestStat) {
+	var flaky, all []TestStat
+	for _, pkg := range results {
+		for _, t := range pkg.Tests {
+			stat := TestStat{Package: pkg.Package, TestResult: t}
+			if t.Flaky {
+				flaky = append(flaky, stat)
+			}
+			if t.Status != testSkip {
+				all = append(all, stat)
+			}
+		}
 	}
-	if err := generateJSON(summaries, testCoverage, "go_code_summary.json"); err != nil {
-		errors = append(errors, fmt.Errorf("generating JSON: %w", err))
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].P95 != all[j].P95 {
+			return all[i].P95 > all[j].P95
+		}
+		if all[i].Package != all[j].Package {
+			return all[i].Package < all[j].Package
+		}
+		return all[i].Name < all[j].Name
+	})
+	if len(all) > slowestTests {
+		all = all[:slowestTests]
 	}
+	return flaky, all
+}
 
-	if len(errors) > 0 {
-		for _, err := range errors {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		}
-		os.Exit(1)
+// testTotals counts the passed, failed and skipped tests over all packages.
+func testTotals(results []PackageTestResult) (passed, failed, skipped int) {
+	for _, pkg := range results {
+		passed += pkg.Passed
+		failed += pkg.Failed
+		skipped += pkg.Skipped
 	}
+	return passed, failed, skipped
+}
 
-	fmt.Println("Generated go_code_summary.md, go_code_summary.html, and go_code_summary.json")
+// junitTestSuites is the root element of a JUnit XML report, with one suite per package.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite is the suite of a package, with one test case per test.
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
 }
 
-func reportTestCoverage(path string) float64 {
+// junitTestCase is a test, with a failure or skipped element unless it passed.
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
 
-	cmd := exec.Command("go", "mod", "tidy")
+// junitMessage is a failure or skipped element; a failure carries the output as its text.
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
 
-	// Run the command and capture the output
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Println("Error running go mod tidy:", err)
-		return 0.0
+// writeJUnit writes the test results as JUnit XML for CI dashboards. A package that failed
+// without a failing test, e.g. because it did not build, gets a failed test case named after
+// the package so that the failure is not lost.
+func writeJUnit(results []PackageTestResult, outputPath string) error {
+	seconds := func(elapsed float64) string { return strconv.FormatFloat(elapsed, 'f', 3, 64) }
+	report := junitTestSuites{}
+	var elapsed float64
+	for _, pkg := range results {
+		suite := junitTestSuite{Name: pkg.Package, Time: seconds(pkg.Elapsed), Skipped: pkg.Skipped, Failures: pkg.Failed}
+		for _, t := range pkg.Tests {
+			tc := junitTestCase{ClassName: pkg.Package, Name: t.Name, Time: seconds(t.Elapsed)}
+			switch t.Status {
+			case testFail:
+				tc.Failure = &junitMessage{Message: fmt.Sprintf("Failed %d of %d runs", t.Failures, t.Runs), Text: t.Output}
+			case testSkip:
+				tc.Skipped = &junitMessage{Message: "Skipped"}
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		if pkg.Status == testFail && pkg.Failed == 0 {
+			suite.TestCases = append(suite.TestCases, junitTestCase{ClassName: pkg.Package, Name: pkg.Package, Time: seconds(pkg.Elapsed),
+				Failure: &junitMessage{Message: "Package failed", Text: pkg.Output}})
+			suite.Failures++
+		}
+		suite.Tests = len(suite.TestCases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+		elapsed += pkg.Elapsed
+		report.Suites = append(report.Suites, suite)
 	}
-	fmt.Printf("go mod tidy result: %v\n", string(output))
+	report.Time = seconds(elapsed)
 
-	err = runTests(path)
+	data, err := xml.MarshalIndent(report, "", "  ")
 	if err != nil {
-		return 0.0
+		return fmt.Errorf("encoding JUnit XML: %w", err)
 	}
+	data = append([]byte(xml.Header), data...)
+	return os.WriteFile(outputPath, append(data, '\n'), 0644)
+}
 
-	report := parseReport(err)
-
-	return scanResult(report)
+// coverBlock is a block of a Go cover profile. File is the file's import path, e.g.
+// example.com/mod/pkg/file.go.
+type coverBlock struct {
+	File      string
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmt   int
+	Count     int
 }
 
-func runTests(path string) error {
-	out, err := exec.Command("go", "list", "./...").Output()
-	if err != nil {
-		fmt.Printf("failed to list packages: %v\n", err)
-		return err
+// parseCoverProfile reads a cover profile as written by go test -coverprofile and returns its
+// mode (set, count or atomic) and blocks.
+func parseCoverProfile(r io.Reader) (string, []coverBlock, error) {
+	var mode string
+	var blocks []coverBlock
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if m, ok := strings.CutPrefix(text, "mode:"); ok {
+			mode = strings.TrimSpace(m)
+			continue
+		}
+		// file.go:startLine.startCol,endLine.endCol numStmt count
+		var b coverBlock
+		colon := strings.LastIndex(text, ":")
+		if colon < 0 {
+			return "", nil, fmt.Errorf("cover profile line %d: missing file name", line)
+		}
+		b.File = text[:colon]
+		if _, err := fmt.Sscanf(text[colon+1:], "%d.%d,%d.%d %d %d", &b.StartLine, &b.StartCol, &b.EndLine, &b.EndCol, &b.NumStmt, &b.Count); err != nil {
+			return "", nil, fmt.Errorf("cover profile line %d: %w", line, err)
+		}
+		blocks = append(blocks, b)
 	}
-	packages := strings.Fields(string(out)) // split by lines or spaces
-
-	args := append([]string{"test", "-coverprofile=coverage.out"}, packages...)
-	cmd := exec.Command("go", args...)
+	if err := scanner.Err(); err != nil {
+		return "", nil, fmt.Errorf("reading cover profile: %w", err)
+	}
+	if mode == "" {
+		return "", nil, fmt.Errorf("cover profile has no mode line")
+	}
+	return mode, blocks, nil
+}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
-	if err != nil {
-		fmt.Printf("tests failed: %v\n", err)
+// readCoverProfiles parses the cover profiles at paths and merges them into one set of
+// blocks. Counts of the same block are added in count and atomic mode; once any profile is in
+// set mode, the merged profile is in set mode and a block is 1 if it ran in any profile.
+func readCoverProfiles(paths []string) (string, []coverBlock, error) {
+	mode := ""
+	var all []coverBlock
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", nil, fmt.Errorf("reading cover profile: %w", err)
+		}
+		m, blocks, err := parseCoverProfile(f)
+		f.Close()
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", path, err)
+		}
+		switch {
+		case mode == "" || m == "set":
+			mode = m
+		case mode == "atomic" && m == "count":
+			mode = "count"
+		}
+		all = append(all, blocks...)
 	}
-	return err
+	return mode, mergeCoverBlocks(mode, all), nil
 }
 
-func parseReport(err error) []byte {
-	parse := exec.Command("go", "tool", "cover", "-func=coverage.out")
-	output, err := parse.Output()
-	if err != nil {
-		fmt.Printf("Failed to parse coverage: %v", err)
+// mergeCoverBlocks combines the occurrences of each block, keeping the order of first
+// occurrence. The profiles of several packages or test runs repeat the blocks they share.
+func mergeCoverBlocks(mode string, blocks []coverBlock) []coverBlock {
+	type span struct {
+		file                                 string
+		startLine, startCol, endLine, endCol int
+	}
+	index := make(map[span]int)
+	var merged []coverBlock
+	for _, b := range blocks {
+		key := span{b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, b)
+			i = len(merged) - 1
+		} else {
+			merged[i].Count += b.Count
+		}
+		if mode == "set" && merged[i].Count > 0 {
+			merged[i].Count = 1
+		}
 	}
-	fmt.Println(string(output))
-	return output
+	return merged
 }
 
-func scanResult(output []byte) float64 {
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-	var total string
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "total:") {
-			total = line
-			break
+// coveragePercent returns the share of statements in blocks that ran.
+func coveragePercent(blocks []coverBlock) float64 {
+	var total, hit int
+	for _, b := range blocks {
+		total += b.NumStmt
+		if b.Count > 0 {
+			hit += b.NumStmt
 		}
 	}
-	trimmed := strings.TrimSuffix(strings.Fields(total)[len(strings.Fields(total))-1], "%")
-	t, err := strconv.ParseFloat(trimmed, 64)
-	if err != nil {
-		fmt.Printf("Failed to parse total to float64: %v", err)
+	if total == 0 {
+		return 0
 	}
-	return t
+	return float64(hit) / float64(total) * 100
 }
@@ -0,0 +1,1315 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// gocycloName formats a function name the way gocyclo does, e.g. "(*Stack[T]).Pop".
+func gocycloName(funcDecl *ast.FuncDecl) string {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return funcDecl.Name.Name
+	}
+	var recv func(ast.Expr) string
+	recv = func(expr ast.Expr) string {
+		switch t := expr.(type) {
+		case *ast.Ident:
+			return t.Name
+		case *ast.StarExpr:
+			return "*" + recv(t.X)
+		case *ast.IndexExpr:
+			return recv(t.X) + "[" + recv(t.Index) + "]"
+		case *ast.IndexListExpr:
+			var params []string
+			for _, index := range t.Indices {
+				params = append(params, recv(index))
+			}
+			return recv(t.X) + "[" + strings.Join(params, ", ") + "]"
+		}
+		return "BADRECV"
+	}
+	return fmt.Sprintf("(%s).%s", recv(funcDecl.Recv.List[0].Type), funcDecl.Name.Name)
+}
+
+// TestCyclomaticGolden checks calcFuncMetrics against gocyclo's output for the corpus in
+// testdata/cyclomatic. The golden file uses gocyclo's "<complexity> <pkg> <func> <pos>" format.
+func TestCyclomaticGolden(t *testing.T) {
+	dir := filepath.Join("testdata", "cyclomatic")
+	golden, err := os.Open(filepath.Join(dir, "gocyclo.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer golden.Close()
+
+	want := make(map[string]int)
+	scanner := bufio.NewScanner(golden)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		complexity, err := strconv.Atoi(fields[0])
+		if err != nil {
+			t.Fatalf("bad golden line %q: %v", scanner.Text(), err)
+		}
+		// Function names of generic receivers contain spaces, e.g. "(Pair[K, V]).Equal".
+		name := strings.Join(fields[2:len(fields)-1], " ")
+		want[name+" "+fields[len(fields)-1]] = complexity
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, file := range files {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			pos := fset.Position(funcDecl.Pos())
+			key := fmt.Sprintf("%s %s:%d:%d", gocycloName(funcDecl), filepath.Base(file), pos.Line, pos.Column)
+			complexity, breakdown, _ := calcFuncMetrics(funcDecl)
+			if complexity != 1+breakdown.Total() {
+				t.Errorf("%s: complexity %d does not match breakdown %+v", key, complexity, breakdown)
+			}
+			got[key] = complexity
+		}
+	}
+
+	for key, complexity := range want {
+		if got[key] != complexity {
+			t.Errorf("%s: got complexity %d, gocyclo reports %d", key, got[key], complexity)
+		}
+	}
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("%s: missing from gocyclo.golden", key)
+		}
+	}
+}
+
+func TestCalcFuncMetricsBreakdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		breakdown ComplexityBreakdown
+		depth     int
+	}{
+		{
+			name:      "else if chain stays at one level",
+			src:       "func f(x int) { if x < 0 {} else if x == 0 {} else if x > 9 {} }",
+			breakdown: ComplexityBreakdown{If: 3},
+			depth:     1,
+		},
+		{
+			name:      "switch cases and boolean operators",
+			src:       "func f(a, b bool, n int) { switch n { case 1, 2: case 3: default: }; _ = a && b || a }",
+			breakdown: ComplexityBreakdown{Case: 2, And: 1, Or: 1},
+			depth:     1,
+		},
+		{
+			name:      "select skips default",
+			src:       "func f(c chan int) { for { select { case <-c: case c <- 1: default: } } }",
+			breakdown: ComplexityBreakdown{For: 1, Comm: 2},
+			depth:     2,
+		},
+		{
+			name:      "nested loops",
+			src:       "func f(g [][]int) { for _, r := range g { for i := range r { if i > 0 {} } } }",
+			breakdown: ComplexityBreakdown{Range: 2, If: 1},
+			depth:     3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "src.go", "package p\n"+tt.src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			funcDecl := f.Decls[0].(*ast.FuncDecl)
+			complexity, breakdown, depth := calcFuncMetrics(funcDecl)
+			if breakdown != tt.breakdown {
+				t.Errorf("breakdown = %+v, want %+v", breakdown, tt.breakdown)
+			}
+			if complexity != 1+tt.breakdown.Total() {
+				t.Errorf("complexity = %d, want %d", complexity, 1+tt.breakdown.Total())
+			}
+			if depth != tt.depth {
+				t.Errorf("depth = %d, want %d", depth, tt.depth)
+			}
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"*.pb.go", "api/v1/service.pb.go", true},
+		{"*.pb.go", "service.go", false},
+		{"mocks", "internal/mocks", true},
+		{"mocks/**", "mocks", true},
+		{"mocks/**", "mocks/deep/m.go", true},
+		{"mocks/**", "internal/mocks/m.go", false},
+		{"**/mocks/*.go", "mocks/m.go", true},
+		{"**/mocks/*.go", "a/b/mocks/m.go", true},
+		{"**/mocks/*.go", "a/b/mocks/deep/m.go", false},
+		{"./cmd/*/main.go", "cmd/app/main.go", true},
+		{"cmd/*/main.go", "cmd/main.go", false},
+		{"a/**/b/**/c.go", "a/x/b/y/z/c.go", true},
+		{"a/**/b/**/c.go", "a/b/c.go", true},
+		{"[", "[", false},
+	}
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestIsTestName(t *testing.T) {
+	tests := []struct {
+		name, prefix string
+		want         bool
+	}{
+		{"Test", "Test", true},
+		{"TestParse", "Test", true},
+		{"Test_parse", "Test", true},
+		{"Test1", "Test", true},
+		{"Testify", "Test", false},
+		{"Testé", "Test", false},
+		{"TestÉcole", "Test", true},
+		{"BenchmarkSort", "Benchmark", true},
+		{"Benchmarks", "Benchmark", false},
+		{"ExampleParse", "Example", true},
+		{"Example_suffix", "Example", true},
+		{"Examples", "Example", false},
+		{"Exampleish", "Example", false},
+		{"helper", "Test", false},
+	}
+	for _, tt := range tests {
+		if got := isTestName(tt.name, tt.prefix); got != tt.want {
+			t.Errorf("isTestName(%q, %q) = %v, want %v", tt.name, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestIsTableDriven(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want bool
+	}{
+		{
+			name: "inline slice",
+			src:  "func TestF(t *testing.T) { for _, tt := range []struct{ in int }{{1}, {2}} { _ = tt } }",
+			want: true,
+		},
+		{
+			name: "local variable",
+			src:  "func TestF(t *testing.T) { tests := map[string]int{\"a\": 1}; for name := range tests { _ = name } }",
+			want: true,
+		},
+		{
+			name: "local var declaration",
+			src:  "func TestF(t *testing.T) { var cases = []int{1, 2}; for _, c := range cases { _ = c } }",
+			want: true,
+		},
+		{
+			name: "package-level table",
+			src:  "var cases = []string{\"a\", \"b\"}\nfunc TestF(t *testing.T) { for _, c := range cases { _ = c } }",
+			want: true,
+		},
+		{
+			name: "empty literal",
+			src:  "func TestF(t *testing.T) { for range []int{} {} }",
+			want: false,
+		},
+		{
+			name: "ranging over a call",
+			src:  "func TestF(t *testing.T) { for _, c := range load() { _ = c } }",
+			want: false,
+		},
+		{
+			name: "no loop",
+			src:  "func TestF(t *testing.T) { tests := []int{1}; _ = tests }",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "src_test.go", "package p\n"+tt.src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			funcDecl := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+			if got := isTableDriven(funcDecl, tableVars(f.Decls)); got != tt.want {
+				t.Errorf("isTableDriven = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCognitiveComplexity(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want int
+	}{
+		{
+			name: "else if and else add one each without nesting",
+			src:  "func f(x int) { if x > 0 {} else if x < 0 {} else {} }",
+			want: 3,
+		},
+		{
+			name: "nesting penalty",
+			src:  "func f(xs []int) { for _, x := range xs { if x > 0 { switch x { case 1: } } } }",
+			want: 1 + 2 + 3,
+		},
+		{
+			name: "sequences of like boolean operators",
+			src:  "func f(a, b, c, d bool) bool { return a && b && c || d }",
+			want: 2,
+		},
+		{
+			name: "parentheses start a new sequence",
+			src:  "func f(a, b, c bool) bool { return a && (b || c) }",
+			want: 2,
+		},
+		{
+			name: "recursive call",
+			src:  "func f(n int) int { if n == 0 { return 0 }; return f(n - 1) }",
+			want: 2,
+		},
+		{
+			name: "recursive method call through the receiver",
+			src:  "func (t *T) Walk() { t.Walk() }",
+			want: 1,
+		},
+		{
+			name: "function literal adds a nesting level",
+			src:  "func f() { go func() { if true {} }() }",
+			want: 2,
+		},
+		{
+			name: "labeled break and goto",
+			src:  "func f() { outer: for { for { break outer } }; goto end; end: return }",
+			want: 1 + 2 + 1 + 1,
+		},
+		{
+			name: "select inside a loop",
+			src:  "func f(c chan int) { for { select { case <-c: return } } }",
+			want: 1 + 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), "src.go", "package p\n"+tt.src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cognitiveComplexity(f.Decls[0].(*ast.FuncDecl)); got != tt.want {
+				t.Errorf("cognitiveComplexity = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeHalstead(t *testing.T) {
+	tests := []struct {
+		name                       string
+		src                        string
+		operators, distinctOps     int
+		operands, distinctOperands int
+	}{
+		{
+			name:      "bracket pairs count once",
+			src:       "x := f(a[i]) + 1",
+			operators: 4, distinctOps: 4, // := ( [ +
+			operands: 5, distinctOperands: 5, // x f a i 1
+		},
+		{
+			name:      "explicit semicolons count, inserted ones do not",
+			src:       "a = a + b; a = a + b\n",
+			operators: 5, distinctOps: 3, // = + ; = +
+			operands: 6, distinctOperands: 2,
+		},
+		{
+			name:      "keywords are operators",
+			src:       "if x { return y() }",
+			operators: 4, distinctOps: 4, // if { return (
+			operands: 2, distinctOperands: 2,
+		},
+		{
+			name:      "string literals are operands by value",
+			src:       `f("a", "a", "b")`,
+			operators: 3, distinctOps: 2, // ( , ,
+			operands: 4, distinctOperands: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := computeHalstead(scanTokens([]byte(tt.src)), 0, len(tt.src))
+			if h.TotalOperators != tt.operators || h.DistinctOperators != tt.distinctOps ||
+				h.TotalOperands != tt.operands || h.DistinctOperands != tt.distinctOperands {
+				t.Fatalf("got N1=%d n1=%d N2=%d n2=%d, want N1=%d n1=%d N2=%d n2=%d", h.TotalOperators, h.DistinctOperators,
+					h.TotalOperands, h.DistinctOperands, tt.operators, tt.distinctOps, tt.operands, tt.distinctOperands)
+			}
+			n, length := float64(h.Vocabulary), float64(h.Length)
+			if want := length * math.Log2(n); math.Abs(h.Volume-want) > 1e-9 {
+				t.Errorf("Volume = %v, want %v", h.Volume, want)
+			}
+			if want := float64(h.DistinctOperators) / 2 * float64(h.TotalOperands) / float64(h.DistinctOperands); math.Abs(h.Difficulty-want) > 1e-9 {
+				t.Errorf("Difficulty = %v, want %v", h.Difficulty, want)
+			}
+		})
+	}
+
+	src := "a := 1\nb := 2\n"
+	if h := computeHalstead(scanTokens([]byte(src)), 0, 7); h.TotalOperands != 2 || h.TotalOperators != 1 {
+		t.Errorf("range [0, 7): got N1=%d N2=%d, want 1 and 2", h.TotalOperators, h.TotalOperands)
+	}
+}
+
+func TestClassifyLines(t *testing.T) {
+	src := "package p // trailing\n" +
+		"\n" +
+		"// Doc comment.\n" +
+		"/* block\n" +
+		"   body\n" +
+		"*/ var x = `raw\n" +
+		"\n" +
+		"string`\n" +
+		"   \t\n" +
+		"func f() {} /* a */ /* b\n" +
+		"end */"
+	want := []lineKind{mixedLine, blankLine, commentLine, commentLine, commentLine, mixedLine, codeLine, codeLine, blankLine, mixedLine, commentLine}
+	got := classifyLines([]byte(src))
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: got kind %d, want %d", i+1, got[i], want[i])
+		}
+	}
+
+	c := countLineKinds(got, 1, len(got))
+	if want := (lineCounts{Physical: 11, Source: 5, Comment: 7, Blank: 2, Mixed: 3}); c != want {
+		t.Errorf("countLineKinds = %+v, want %+v", c, want)
+	}
+
+	// A //line directive remaps later positions, but lines are still counted where they are
+	src = "package p\n" +
+		"\n" +
+		"//line other.y:100\n" +
+		"var y = 1\n" +
+		"\n" +
+		"// after\n"
+	want = []lineKind{codeLine, blankLine, commentLine, codeLine, blankLine, commentLine}
+	got = classifyLines([]byte(src))
+	if len(got) != len(want) {
+		t.Fatalf("with //line: got %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("with //line: line %d: got kind %d, want %d", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestFormatTypeDef(t *testing.T) {
+	src := `package p
+
+// Thing is documented.
+type Thing struct {
+	Name string ` + "`json:\"name\"`" + ` // the name
+	io.Reader
+}
+
+type (
+	// Set is generic.
+	Set[K comparable] map[K]struct{}
+
+	Number interface {
+		~int | ~float64
+	}
+)
+
+type Alias = map[string]int
+`
+	want := map[string]string{
+		"Thing":  "type Thing struct {\n\tName string `json:\"name\"` // the name\n\tio.Reader\n}",
+		"Set":    "type Set[K comparable] map[K]struct{}",
+		"Number": "type Number interface {\n\t~int | ~float64\n}",
+		"Alias":  "type Alias = map[string]int",
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range f.Decls {
+		genDecl := decl.(*ast.GenDecl)
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			if got := formatTypeDef(fset, f.Comments, genDecl, typeSpec); got != want[typeSpec.Name.Name] {
+				t.Errorf("%s:\ngot  %q\nwant %q", typeSpec.Name.Name, got, want[typeSpec.Name.Name])
+			}
+		}
+	}
+}
+
+func TestFormatFuncSignature(t *testing.T) {
+	tests := []struct {
+		src    string
+		want   string
+		params []Param
+	}{
+		{
+			src:    "func Top(a, b int, xs ...string) (n int, err error) { return }",
+			want:   "func Top(a, b int, xs ...string) (n int, err error)",
+			params: []Param{{Name: "a", Type: "int"}, {Name: "b", Type: "int"}, {Name: "xs", Type: "string", Variadic: true}},
+		},
+		{
+			src:    "func (s *Stack[T]) Push(T) {}",
+			want:   "func (s *Stack[T]) Push(T)",
+			params: []Param{{Type: "T"}},
+		},
+		{
+			src:    "func Map[K comparable, V any](m map[K]V, f func(V) V) map[K]V { return nil }",
+			want:   "func Map[K comparable, V any](m map[K]V, f func(V) V) map[K]V",
+			params: []Param{{Name: "m", Type: "map[K]V"}, {Name: "f", Type: "func(V) V"}},
+		},
+		{
+			src:    "// Doc is dropped.\nfunc f(\n\ta int, // first\n\tb int,\n) {}",
+			want:   "func f(\n\ta int,\n\tb int,\n)",
+			params: []Param{{Name: "a", Type: "int"}, {Name: "b", Type: "int"}},
+		},
+	}
+	for _, tt := range tests {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "p.go", "package p\n"+tt.src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		funcDecl := f.Decls[0].(*ast.FuncDecl)
+		if got := formatFuncSignature(fset, funcDecl); got != tt.want {
+			t.Errorf("signature:\ngot  %q\nwant %q", got, tt.want)
+		}
+		if got := describeParams(fset, funcDecl.Type.Params); fmt.Sprint(got) != fmt.Sprint(tt.params) {
+			t.Errorf("%s: params = %+v, want %+v", funcDecl.Name.Name, got, tt.params)
+		}
+	}
+}
+
+func TestLintDoc(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		checkName bool
+		want      []string
+	}{
+		{"starts with the name", "Foo does things.", true, nil},
+		{"article before the name", "A Foo does things.", true, nil},
+		{"wrong name", "Does things.", true, []string{`doc comment should start with "Foo"`}},
+		{"longer identifier", "Foobar does things.", true, []string{`doc comment should start with "Foo"`}},
+		{"name not checked", "Does things.", false, nil},
+		{"only a TODO", "TODO: document.\nFIXME later.", true, []string{"doc comment is only a TODO"}},
+		{"deprecation paragraph", "Foo does things.\n\nDeprecated: use Bar.", true, nil},
+		{"deprecated in prose", "Foo does things.\n\nDeprecated options are ignored.", true, nil},
+		{"deprecation inside a paragraph", "Foo does things.\nDeprecated: use Bar.", true,
+			[]string{`deprecation notice should be a paragraph starting with "Deprecated: "`}},
+		{"upper-case deprecation", "Foo does things.\n\nDEPRECATED: use Bar.", true,
+			[]string{`deprecation notice should be a paragraph starting with "Deprecated: "`}},
+		{"fenced code block", "Foo does things.\n\n```\nFoo()\n```", true, []string{"code blocks should be indented, not fenced with ```"}},
+		{"doc link", "Foo calls [Bar] and [io.Reader].", true, nil},
+		{"defined link", "Foo follows [the spec].\n\n[the spec]: https://go.dev/ref/spec", true, nil},
+		{"malformed link URL", "Foo follows [the spec].\n\n[the spec]: https://%zz", true,
+			[]string{`link [the spec] has malformed URL "https://%zz"`}},
+		{"unused link definition", "Foo does things.\n\n[the spec]: https://go.dev/ref/spec", true,
+			[]string{"link definition [the spec] is never used"}},
+		{"undefined link", "Foo follows [the spec].", true, nil},
+		{"interval", "Foo returns a value in [0, 100].", true, nil},
+		{"Markdown link", "Foo follows [the spec](https://go.dev/ref/spec).", true,
+			[]string{"Markdown link [the spec](https://go.dev/ref/spec); use [text] with a link definition"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lintDoc("Foo", tt.text+"\n", tt.checkName)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("lintDoc(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	// A type named like an article starts its comment with the name
+	if got := lintDoc("A", "A is the first option.\n", true); len(got) != 0 {
+		t.Errorf("lintDoc(A) = %q, want no findings", got)
+	}
+}
+
+func TestGroupDocFindingNamesExported(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "p.go")
+	src := "package p\n\n// TODO: document.\nvar (\n\tverbose = false\n\tLimit   = 10\n)\n\n// TODO: document.\nvar count, Total = 0, 0\n"
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := parseFile(file, analysisOptions{MaxCyclomatic: 10, MaxCognitive: 15, MaxCRAP: 30, Maintainability: miVisualStudio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, finding := range summary.DocFindings {
+		names = append(names, finding.Name+": "+finding.Message)
+	}
+	want := []string{"Limit: doc comment is only a TODO", "Total: doc comment is only a TODO"}
+	if strings.Join(names, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings = %q, want %q", names, want)
+	}
+}
+
+func TestMethodDocFindingNames(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "p.go")
+	src := "package p\n\n// Alpha is a.\ntype Alpha struct{}\n\n// Beta is b.\ntype Beta struct{}\n\n// Formats a.\nfunc (Alpha) String() string { return \"a\" }\n\n" +
+		"// String formats b.\n//\n// TODO: shorten.\nfunc (*Beta) String() string { return \"b\" }\n\n// Returns b.\nfunc (b *Beta) Len() int { return 0 }\n"
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := parseFile(file, analysisOptions{MaxCyclomatic: 10, MaxCognitive: 15, MaxCRAP: 30, Maintainability: miVisualStudio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, finding := range summary.DocFindings {
+		names = append(names, finding.Kind+" "+finding.Name+": "+finding.Message)
+	}
+	want := []string{`method Alpha.String: doc comment should start with "String"`, `method Beta.Len: doc comment should start with "Len"`}
+	if strings.Join(names, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings = %q, want %q", names, want)
+	}
+}
+
+func TestGraphCollapse(t *testing.T) {
+	opts := graphOptions{ModulePath: "example.com/tgt", Depth: 1}
+	tests := []struct {
+		importPath string
+		want       string
+	}{
+		{"example.com/tgt", "example.com/tgt"},
+		{"example.com/tgt/net", "example.com/tgt/net"},
+		{"example.com/tgt/internal/a/b", "example.com/tgt/internal"},
+		{"example.com/tgtx/a/b", "example.com/tgtx/a/b"},
+		{"net/http", "net/http"},
+		{"github.com/pkg/errors", "github.com/pkg/errors"},
+	}
+	for _, tt := range tests {
+		if got := opts.collapse(tt.importPath); got != tt.want {
+			t.Errorf("collapse(%q) = %q, want %q", tt.importPath, got, tt.want)
+		}
+	}
+
+	summaries := []CodeSummary{{ImportPath: "example.com/tgt"}, {ImportPath: "example.com/tgt/net"}}
+	overview := ProjectOverview{ImportGraph: map[string][]string{
+		"example.com/tgt":     {"example.com/tgt/net", "net/http", "github.com/pkg/errors"},
+		"example.com/tgt/net": {"net"},
+	}}
+	g := buildDependencyGraph(summaries, overview, opts)
+	want := [][2]string{
+		{"example.com/tgt", "example.com/tgt/net"},
+		{"example.com/tgt", "github.com/pkg/errors"},
+		{"example.com/tgt", "net/http"},
+		{"example.com/tgt/net", "net"},
+	}
+	if fmt.Sprint(g.Edges) != fmt.Sprint(want) {
+		t.Errorf("edges = %v, want %v", g.Edges, want)
+	}
+}
+
+func TestPackageZones(t *testing.T) {
+	summaries := []CodeSummary{
+		{Module: "example.com/m", ImportPath: "example.com/m", Package: "m", ImportLines: []ImportLine{{Path: "example.com/m/core", Class: importInternal}}},
+		{Module: "example.com/m", ImportPath: "example.com/m/core", Package: "core", Types: []TypeDecl{{Name: "Store", Kind: "interface"}}},
+		{Module: "example.com/m", ImportPath: "example.com/m/alone", Package: "alone", ImportLines: []ImportLine{{Path: "fmt", Class: importStdlib}}},
+	}
+	tests := []struct {
+		pkg      string
+		zone     string
+		distance float64
+	}{
+		{".", zoneMainSequence, 0},
+		{"core", zoneMainSequence, 0},
+		{"alone", zoneIsolated, 0},
+	}
+	overview := computeProjectOverview(summaries, false)
+	for _, tt := range tests {
+		metric := overview.PackageMetrics[tt.pkg]
+		if metric.Zone != tt.zone || metric.Distance != tt.distance {
+			t.Errorf("package %q: zone %q distance %.2f, want %q %.2f", tt.pkg, metric.Zone, metric.Distance, tt.zone, tt.distance)
+		}
+	}
+
+	for i := range summaries {
+		summaries[i].Module = ""
+	}
+	overview = computeProjectOverview(summaries, false)
+	if overview.CouplingNote == "" {
+		t.Error("CouplingNote is empty without a module path")
+	}
+	for pkg, metric := range overview.PackageMetrics {
+		if metric.Zone != zoneUnknown {
+			t.Errorf("package %q without a module path: zone %q, want %q", pkg, metric.Zone, zoneUnknown)
+		}
+	}
+}
+
+func TestCompileImportPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"internal/...", "internal", true},
+		{"internal/...", "internal/db", true},
+		{"internal/...", "internal/db/sql", true},
+		{"internal/...", "internalx", false},
+		{"internal/...", "pkg/internal/db", false},
+		{".../internal/...", "pkg/internal/db", true},
+		{"cmd/...-tool", "cmd/gen/x-tool", true},
+		{"cmd/...-tool", "cmd/gen/x-tools", false},
+		{"net/http", "net/http", true},
+		{"net/http", "net/httptest", false},
+		{"a.b/c", "axb/c", false},
+	}
+	for _, tt := range tests {
+		re, err := compileImportPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compileImportPattern(%q): %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("compileImportPattern(%q) matches %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+	if _, err := compileImportPattern(""); err == nil {
+		t.Error("compileImportPattern(\"\") succeeded, want an error")
+	}
+}
+
+func TestImportCycles(t *testing.T) {
+	imports := func(paths ...string) []ImportLine {
+		var lines []ImportLine
+		for i, p := range paths {
+			lines = append(lines, ImportLine{Path: p, Position: Position{Line: i + 3}})
+		}
+		return lines
+	}
+	summaries := []CodeSummary{
+		{ImportPath: "m/a", ImportLines: imports("fmt", "m/c", "m/b")},
+		{ImportPath: "m/b", ImportLines: imports("m/a")},
+		{ImportPath: "m/c", ImportLines: imports("m/d")},
+		{ImportPath: "m/d", ImportLines: imports("m/e", "m/d")},
+		{ImportPath: "m/e", ImportLines: imports("m/c")},
+		{ImportPath: "m/f", ImportLines: imports("m/a")},
+	}
+	want := []struct {
+		pkg, imp string
+		line     int
+		message  string
+	}{
+		// Tarjan's algorithm completes the component reached from m/a first
+		{"m/c", "m/d", 3, "import cycle: m/c -> m/d -> m/e -> m/c"},
+		{"m/a", "m/b", 5, "import cycle: m/a -> m/b -> m/a"},
+	}
+	got := importCycles(summaries)
+	if len(got) != len(want) {
+		t.Fatalf("importCycles = %+v, want %d violations", got, len(want))
+	}
+	for i, w := range want {
+		v := got[i]
+		if v.Package != w.pkg || v.Import != w.imp || v.Position.Line != w.line || v.Message != w.message {
+			t.Errorf("violation %d = %s %s line %d %q, want %s %s line %d %q", i, v.Package, v.Import, v.Position.Line, v.Message, w.pkg, w.imp, w.line, w.message)
+		}
+	}
+}
+
+func TestGoCommandsLeaveModuleUnchanged(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	t.Setenv("GO111MODULE", "on")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	root := t.TempDir()
+	files := map[string]string{
+		// Without a go directive, -mod=mod would add one
+		"go.mod":    "module example.com/s2\n",
+		"go.sum":    "",
+		"s.go":      "package s2\n\n// F is f.\nfunc F() int { return 1 }\n",
+		"s_test.go": "package s2\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { F() }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := loadPackages(root, newPathFilter(root, nil, nil)); err != nil {
+		t.Fatalf("loadPackages: %v", err)
+	}
+	results, _, err := runTests(root, filepath.Join(t.TempDir(), "cover.out"), testOptions{Count: 1})
+	if err != nil {
+		t.Fatalf("runTests: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != testPass {
+		t.Errorf("runTests = %+v, want one passing package", results)
+	}
+	for _, name := range []string{"go.mod", "go.sum"} {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != files[name] {
+			t.Errorf("%s was rewritten to %q", name, data)
+		}
+	}
+
+	if got := readOnlyGoFlags(root); got != "-mod=readonly" {
+		t.Errorf("readOnlyGoFlags = %q, want -mod=readonly", got)
+	}
+	t.Setenv("GOFLAGS", "-tags=integration -mod=mod -v")
+	if err := os.MkdirAll(filepath.Join(root, "vendor"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "vendor", "modules.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readOnlyGoFlags(root), "-tags=integration -v -mod=vendor"; got != want {
+		t.Errorf("readOnlyGoFlags with vendor/modules.txt = %q, want %q", got, want)
+	}
+}
+
+func TestParseGoMod(t *testing.T) {
+	root := t.TempDir()
+	goMod := `module "example.com/app" // the app
+
+go 1.22
+
+require github.com/single/dep v0.1.0
+
+require (
+	github.com/pkg/errors v0.9.1
+	golang.org/x/text v0.14.0 // indirect
+	github.com/forked/lib v1.2.0
+)
+
+replace github.com/forked/lib => ../fork
+
+replace (
+	github.com/pkg/errors v0.9.1 => github.com/pkg/errors v0.9.2
+)
+`
+	goSum := `github.com/pkg/errors v0.9.1 h1:abc=
+github.com/pkg/errors v0.9.1/go.mod h1:def=
+github.com/only/insum v1.0.0/go.mod h1:ghi=
+github.com/only/insum v1.0.0 h1:jkl=
+`
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "go.sum"), []byte(goSum), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mod := parseGoMod(root)
+	if mod.Path != "example.com/app" {
+		t.Errorf("Path = %q, want %q", mod.Path, "example.com/app")
+	}
+	wantRequires := []moduleRequirement{
+		{Path: "github.com/single/dep", Version: "v0.1.0"},
+		{Path: "github.com/pkg/errors", Version: "v0.9.1 => github.com/pkg/errors v0.9.2"},
+		{Path: "golang.org/x/text", Version: "v0.14.0", Indirect: true},
+		{Path: "github.com/forked/lib", Version: "v1.2.0 => ../fork"},
+	}
+	if len(mod.Requires) != len(wantRequires) {
+		t.Fatalf("Requires = %+v, want %+v", mod.Requires, wantRequires)
+	}
+	for i, want := range wantRequires {
+		if mod.Requires[i] != want {
+			t.Errorf("Requires[%d] = %+v, want %+v", i, mod.Requires[i], want)
+		}
+	}
+
+	tests := []struct {
+		path        string
+		class       string
+		module      string
+		requirement string
+	}{
+		{"example.com/app/internal/db", importInternal, "", ""},
+		{"example.com/application", importExternal, "example.com/application", requireMissing},
+		{"net/http", importStdlib, "", ""},
+		{"github.com/pkg/errors", importExternal, "github.com/pkg/errors", requireDirect},
+		{"golang.org/x/text/unicode/norm", importExternal, "golang.org/x/text", requireIndirect},
+		{"github.com/only/insum/sub", importExternal, "github.com/only/insum", requireSumOnly},
+	}
+	imports := make([]ImportLine, len(tests))
+	for i, tt := range tests {
+		imports[i].Path = tt.path
+	}
+	mod.classify(imports)
+	for i, tt := range tests {
+		imp := imports[i]
+		if imp.Class != tt.class || imp.Module != tt.module || imp.Requirement != tt.requirement {
+			t.Errorf("classify(%q) = %s %q %q, want %s %q %q", tt.path, imp.Class, imp.Module, imp.Requirement, tt.class, tt.module, tt.requirement)
+		}
+	}
+
+	if empty := parseGoMod(t.TempDir()); empty.Path != "" || len(empty.Requires) != 0 {
+		t.Errorf("parseGoMod without go.mod = %+v, want an empty module", empty)
+	}
+}
+
+func TestReadCoverProfiles(t *testing.T) {
+	dir := t.TempDir()
+	profiles := map[string]string{
+		"count.out": `mode: count
+example.com/m/a.go:3.14,5.2 2 3
+example.com/m/a.go:7.14,9.2 1 0
+example.com/m/b.go:4.20,6.2 1 0
+`,
+		"atomic.out": `mode: atomic
+example.com/m/a.go:3.14,5.2 2 4
+example.com/m/b.go:4.20,6.2 1 2
+example.com/m/a.go:3.14,4.10 1 1
+`,
+		"set.out": `mode: set
+example.com/m/a.go:7.14,9.2 1 0
+example.com/m/b.go:4.20,6.2 1 1
+`,
+		"nomode.out": "example.com/m/a.go:3.14,5.2 2 3\n",
+		"bad.out":    "mode: set\nexample.com/m/a.go:3.14 2 3\n",
+	}
+	for name, content := range profiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		files  []string
+		mode   string
+		counts []int
+		err    bool
+	}{
+		// Blocks in order of first occurrence: a.go 3-5, a.go 7-9, b.go 4-6, then the nested a.go 3-4
+		{"count", []string{"count.out"}, "count", []int{3, 0, 0}, false},
+		{"count and atomic", []string{"count.out", "atomic.out"}, "count", []int{7, 0, 2, 1}, false},
+		{"atomic and count", []string{"atomic.out", "count.out"}, "count", []int{7, 2, 1, 0}, false},
+		{"set last", []string{"count.out", "atomic.out", "set.out"}, "set", []int{1, 0, 1, 1}, false},
+		{"set first", []string{"set.out", "count.out"}, "set", []int{0, 1, 1}, false},
+		{"missing mode", []string{"nomode.out"}, "", nil, true},
+		{"malformed block", []string{"count.out", "bad.out"}, "", nil, true},
+		{"missing file", []string{"absent.out"}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, f := range tt.files {
+				paths = append(paths, filepath.Join(dir, f))
+			}
+			mode, blocks, err := readCoverProfiles(paths)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("readCoverProfiles(%v) succeeded, want an error", tt.files)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readCoverProfiles(%v): %v", tt.files, err)
+			}
+			var counts []int
+			for _, b := range blocks {
+				counts = append(counts, b.Count)
+			}
+			if mode != tt.mode || fmt.Sprint(counts) != fmt.Sprint(tt.counts) {
+				t.Errorf("readCoverProfiles(%v) = %s %v, want %s %v", tt.files, mode, counts, tt.mode, tt.counts)
+			}
+		})
+	}
+}
+
+func TestCrapScore(t *testing.T) {
+	tests := []struct {
+		complexity int
+		coverage   float64
+		want       float64
+	}{
+		{1, 100, 1},
+		{10, 100, 10},
+		{6, 0, 42},
+		{4, 50, 6},
+		{2, 75, 2.0625},
+	}
+	for _, tt := range tests {
+		if got := crapScore(tt.complexity, tt.coverage); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("crapScore(%d, %v) = %v, want %v", tt.complexity, tt.coverage, got, tt.want)
+		}
+	}
+}
+
+func TestApplyCoverage(t *testing.T) {
+	summaries := []CodeSummary{
+		{
+			ImportPath: "example.com/m/p",
+			Filename:   "/src/m/p/a.go",
+			Functions: []FuncDecl{
+				{Name: "Risky", Position: Position{Line: 3, EndLine: 10}, Complexity: 4},
+				{Name: "Nested", Position: Position{Line: 12, EndLine: 20}, Complexity: 2},
+				{Name: "Empty", Position: Position{Line: 22, EndLine: 22}, Complexity: 1},
+			},
+			LongFunctions: []FuncDecl{{Name: "Risky", Position: Position{Line: 3, EndLine: 10}}},
+		},
+		{ImportPath: "example.com/m/q", Filename: "/src/m/q/b.go", Functions: []FuncDecl{{Name: "Untested", Position: Position{Line: 3, EndLine: 5}, Complexity: 9}}},
+	}
+	blocks := []coverBlock{
+		{File: "example.com/m/p/a.go", StartLine: 3, EndLine: 5, NumStmt: 2, Count: 1},
+		{File: "example.com/m/p/a.go", StartLine: 5, EndLine: 9, NumStmt: 2, Count: 0},
+		{File: "example.com/m/p/a.go", StartLine: 12, EndLine: 20, NumStmt: 3, Count: 2},
+		// A function literal inside Nested
+		{File: "example.com/m/p/a.go", StartLine: 14, EndLine: 16, NumStmt: 1, Count: 0},
+		{File: "example.com/m/p/other.go", StartLine: 3, EndLine: 9, NumStmt: 5, Count: 0},
+		{File: "example.com/m/a.go", StartLine: 3, EndLine: 9, NumStmt: 5, Count: 0},
+	}
+	applyCoverage(summaries, blocks, 5)
+
+	s := summaries[0]
+	if !s.HasCoverage || s.Statements != 8 || s.CoveredStatements != 5 || s.TestCoverage != 62.5 {
+		t.Errorf("file coverage = %v %d/%d %.2f%%, want true 5/8 62.50%%", s.HasCoverage, s.CoveredStatements, s.Statements, s.TestCoverage)
+	}
+	tests := []struct {
+		name                string
+		statements, covered int
+		coverage, crap      float64
+	}{
+		{"Risky", 4, 2, 50, 6},
+		{"Nested", 4, 3, 75, 2.0625},
+		{"Empty", 0, 0, 100, 1},
+	}
+	for i, tt := range tests {
+		f := s.Functions[i]
+		if f.Statements != tt.statements || f.CoveredStatements != tt.covered || f.Coverage != tt.coverage || f.CRAP != tt.crap {
+			t.Errorf("%s: %d/%d statements, coverage %.2f, CRAP %.4f, want %d/%d, %.2f, %.4f",
+				tt.name, f.CoveredStatements, f.Statements, f.Coverage, f.CRAP, tt.covered, tt.statements, tt.coverage, tt.crap)
+		}
+	}
+	if s.LongFunctions[0].CRAP != 6 {
+		t.Errorf("LongFunctions[0].CRAP = %v, want 6", s.LongFunctions[0].CRAP)
+	}
+	if len(s.Problems) != 1 || s.Problems[0].FunctionName != "Risky" || s.Problems[0].Reason != "CRAP score 6.0 (> 5) at 50% coverage" {
+		t.Errorf("Problems = %+v, want Risky with CRAP score 6.0", s.Problems)
+	}
+	if q := summaries[1]; q.HasCoverage || q.Functions[0].CRAP != 0 || len(q.Problems) != 0 {
+		t.Errorf("file missing from the profile got coverage: %+v", q)
+	}
+
+	summaries = append(summaries, CodeSummary{
+		ImportPath:  "example.com/m/p",
+		Generated:   true,
+		HasCoverage: true,
+		Functions:   []FuncDecl{{Name: "Generated", CRAP: 90}},
+	})
+	var got []string
+	for _, f := range highestRisk(summaries, false) {
+		got = append(got, f.Function)
+	}
+	if want := []string{"Risky", "Nested", "Empty"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("highestRisk = %v, want %v", got, want)
+	}
+	if risk := highestRisk(summaries, true); risk[0].Function != "Generated" {
+		t.Errorf("highestRisk with generated files starts with %s, want Generated", risk[0].Function)
+	}
+}
+
+func TestParseTestEvents(t *testing.T) {
+	stream := `{"Action":"start","Package":"example.com/m/ok"}
+{"Action":"run","Package":"example.com/m/ok","Test":"TestPass"}
+{"Action":"output","Package":"example.com/m/ok","Test":"TestPass","Output":"=== RUN   TestPass\n"}
+{"Action":"pass","Package":"example.com/m/ok","Test":"TestPass","Elapsed":0.5}
+{"Action":"run","Package":"example.com/m/ok","Test":"TestFail"}
+{"Action":"output","Package":"example.com/m/ok","Test":"TestFail","Output":"    ok_test.go:9: got 1, want 2\n"}
+{"Action":"fail","Package":"example.com/m/ok","Test":"TestFail","Elapsed":0.25}
+{"Action":"run","Package":"example.com/m/ok","Test":"TestSkip"}
+{"Action":"skip","Package":"example.com/m/ok","Test":"TestSkip"}
+{"Action":"output","Package":"example.com/m/ok","Output":"FAIL\n"}
+{"Action":"fail","Package":"example.com/m/ok","Elapsed":1.5}
+{"Action":"run","Package":"example.com/m/panics","Test":"TestPanic"}
+{"Action":"output","Package":"example.com/m/panics","Test":"TestPanic","Output":"panic: boom\n"}
+{"Action":"output","Package":"example.com/m/panics","Output":"FAIL\texample.com/m/panics\t0.01s\n"}
+{"Action":"fail","Package":"example.com/m/panics","Elapsed":0.01}
+{"ImportPath":"example.com/m/broken [example.com/m/broken.test]","Action":"build-output","Output":"# example.com/m/broken\n"}
+{"ImportPath":"example.com/m/broken [example.com/m/broken.test]","Action":"build-output","Output":"broken.go:3:1: syntax error\n"}
+{"ImportPath":"example.com/m/broken [example.com/m/broken.test]","Action":"build-fail"}
+{"Action":"start","Package":"example.com/m/broken"}
+{"Action":"fail","Package":"example.com/m/broken","Elapsed":0,"FailedBuild":"example.com/m/broken [example.com/m/broken.test]"}
+FAIL	example.com/m/setup [setup failed]
+{"Action":"skip","Package":"example.com/m/notests","Elapsed":0}
+`
+	results, races := parseTestEvents(strings.NewReader(stream))
+	if len(races) != 0 {
+		t.Errorf("races = %+v, want none", races)
+	}
+	type testWant struct {
+		name, status  string
+		runs, failure int
+		output        string
+	}
+	want := []struct {
+		pkg                     string
+		status                  string
+		passed, failed, skipped int
+		output                  string
+		tests                   []testWant
+	}{
+		{"example.com/m/broken", testFail, 0, 0, 0, "# example.com/m/broken\nbroken.go:3:1: syntax error\n", nil},
+		{"example.com/m/notests", testSkip, 0, 0, 0, "", nil},
+		{"example.com/m/ok", testFail, 1, 1, 1, "", []testWant{
+			{"TestPass", testPass, 1, 0, ""},
+			{"TestFail", testFail, 1, 1, "    ok_test.go:9: got 1, want 2\n"},
+			{"TestSkip", testSkip, 1, 0, ""},
+		}},
+		// The test never finishes, so it counts as failed with the panic as its output
+		{"example.com/m/panics", testFail, 0, 1, 0, "", []testWant{
+			{"TestPanic", testFail, 1, 1, "panic: boom\n"},
+		}},
+		{"example.com/m/setup", testFail, 0, 0, 0, "FAIL\texample.com/m/setup [setup failed]\n", nil},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("parseTestEvents returned %d packages, want %d: %+v", len(results), len(want), results)
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.Package != w.pkg || r.Status != w.status || r.Passed != w.passed || r.Failed != w.failed || r.Skipped != w.skipped || r.Output != w.output {
+			t.Errorf("package %d = %s %s %d/%d/%d %q, want %s %s %d/%d/%d %q", i, r.Package, r.Status, r.Passed, r.Failed, r.Skipped, r.Output,
+				w.pkg, w.status, w.passed, w.failed, w.skipped, w.output)
+		}
+		if len(r.Tests) != len(w.tests) {
+			t.Errorf("%s: %d tests, want %d", w.pkg, len(r.Tests), len(w.tests))
+			continue
+		}
+		for j, wt := range w.tests {
+			got := r.Tests[j]
+			if got.Name != wt.name || got.Status != wt.status || got.Runs != wt.runs || got.Failures != wt.failure || got.Output != wt.output {
+				t.Errorf("%s test %d = %s %s %d runs %d failures %q, want %s %s %d %d %q", w.pkg, j, got.Name, got.Status, got.Runs, got.Failures, got.Output,
+					wt.name, wt.status, wt.runs, wt.failure, wt.output)
+			}
+		}
+	}
+}
+
+func TestParseTestEventsRepeated(t *testing.T) {
+	// go test -json -count=3 with one stable and one flaky test
+	var b strings.Builder
+	runs := []struct {
+		test    string
+		action  string
+		elapsed float64
+	}{
+		{"TestStable", testPass, 0.1}, {"TestFlaky", testPass, 0.2},
+		{"TestStable", testPass, 0.3}, {"TestFlaky", testFail, 0.4},
+		{"TestStable", testPass, 0.2}, {"TestFlaky", testPass, 0.9},
+	}
+	for _, r := range runs {
+		fmt.Fprintf(&b, `{"Action":"run","Package":"example.com/m","Test":%q}`+"\n", r.test)
+		if r.action == testFail {
+			fmt.Fprintf(&b, `{"Action":"output","Package":"example.com/m","Test":%q,"Output":"    flaky_test.go:7: timed out\n"}`+"\n", r.test)
+		}
+		fmt.Fprintf(&b, `{"Action":%q,"Package":"example.com/m","Test":%q,"Elapsed":%v}`+"\n", r.action, r.test, r.elapsed)
+	}
+	b.WriteString(`{"Action":"fail","Package":"example.com/m","Elapsed":2.1}` + "\n")
+
+	results, _ := parseTestEvents(strings.NewReader(b.String()))
+	if len(results) != 1 {
+		t.Fatalf("parseTestEvents returned %d packages, want 1", len(results))
+	}
+	pkg := results[0]
+	if pkg.Passed != 1 || pkg.Failed != 1 || pkg.Flaky != 1 {
+		t.Errorf("package counts passed %d failed %d flaky %d, want 1 1 1", pkg.Passed, pkg.Failed, pkg.Flaky)
+	}
+	tests := []struct {
+		name      string
+		status    string
+		flaky     bool
+		failures  int
+		mean, p95 float64
+		output    string
+	}{
+		{"TestStable", testPass, false, 0, 0.2, 0.3, ""},
+		{"TestFlaky", testFail, true, 1, 0.5, 0.9, "    flaky_test.go:7: timed out\n"},
+	}
+	for i, tt := range tests {
+		got := pkg.Tests[i]
+		if got.Name != tt.name || got.Status != tt.status || got.Flaky != tt.flaky || got.Runs != 3 || got.Failures != tt.failures ||
+			math.Abs(got.Elapsed-tt.mean) > 1e-9 || got.P95 != tt.p95 || got.Output != tt.output {
+			t.Errorf("test %d = %+v, want %s %s flaky %v 3 runs %d failures mean %.2f p95 %.2f %q", i, got, tt.name, tt.status, tt.flaky, tt.failures, tt.mean, tt.p95, tt.output)
+		}
+	}
+
+	flaky, slowest := flakyAndSlowest(results)
+	if len(flaky) != 1 || flaky[0].Name != "TestFlaky" {
+		t.Errorf("flaky = %+v, want TestFlaky", flaky)
+	}
+	if len(slowest) != 2 || slowest[0].Name != "TestFlaky" || slowest[1].Name != "TestStable" {
+		t.Errorf("slowest = %+v, want TestFlaky, TestStable", slowest)
+	}
+}
+
+func TestMeanAndP95(t *testing.T) {
+	twenty := make([]float64, 20)
+	for i := range twenty {
+		twenty[i] = float64(20 - i)
+	}
+	tests := []struct {
+		durations []float64
+		mean, p95 float64
+	}{
+		{nil, 0, 0},
+		{[]float64{2}, 2, 2},
+		{[]float64{3, 1, 2}, 2, 3},
+		// The nearest rank of 20 durations is the 19th, so the slowest run is an outlier
+		{twenty, 10.5, 19},
+		{append(twenty, 100), 100.0/21 + 10, 20},
+	}
+	for _, tt := range tests {
+		mean, p95 := meanAndP95(tt.durations)
+		if math.Abs(mean-tt.mean) > 1e-9 || p95 != tt.p95 {
+			t.Errorf("meanAndP95(%v) = %v, %v, want %v, %v", tt.durations, mean, p95, tt.mean, tt.p95)
+		}
+	}
+}
+
+// raceReport is a race detector report as printed by go test -race.
+const raceReport = `==================
+WARNING: DATA RACE
+Write at 0x00c0000a0018 by goroutine 8:
+  example.com/m.(*Counter).Inc()
+      /src/m/counter.go:12 +0x44
+  example.com/m.TestInc.func1()
+      /src/m/counter_test.go:15 +0x2e
+
+Previous write at 0x00c0000a0018 by goroutine 7:
+  example.com/m.(*Counter).Inc()
+      /src/m/counter.go:12 +0x44
+  example.com/m.helper()
+      /src/m/counter.go:20 +0x30
+
+Goroutine 8 (running) created at:
+  example.com/m.TestInc()
+      /src/m/counter_test.go:14 +0x7c
+  testing.tRunner()
+      /usr/local/go/src/testing/testing.go:1689 +0x21e
+
+Goroutine 7 (finished) created at:
+  example.com/m.TestInc()
+      /src/m/counter_test.go:14 +0x7c
+==================
+`
+
+func TestParseDataRace(t *testing.T) {
+	lines := strings.Split(raceReport, "\n")
+	race := parseDataRace("example.com/m", "TestInc", lines[2:len(lines)-2])
+	if race.Package != "example.com/m" || race.Test != "TestInc" || race.Count != 1 {
+		t.Errorf("race = %s %s count %d, want example.com/m TestInc count 1", race.Package, race.Test, race.Count)
+	}
+	tests := []struct {
+		stack  RaceStack
+		header string
+		frames []StackFrame
+	}{
+		{race.Accesses[0], "Write at 0x00c0000a0018 by goroutine 8", []StackFrame{
+			{"example.com/m.(*Counter).Inc", "/src/m/counter.go", 12},
+			{"example.com/m.TestInc.func1", "/src/m/counter_test.go", 15},
+		}},
+		{race.Accesses[1], "Previous write at 0x00c0000a0018 by goroutine 7", []StackFrame{
+			{"example.com/m.(*Counter).Inc", "/src/m/counter.go", 12},
+			{"example.com/m.helper", "/src/m/counter.go", 20},
+		}},
+		{race.Goroutines[0], "Goroutine 8 (running) created at", []StackFrame{
+			{"example.com/m.TestInc", "/src/m/counter_test.go", 14},
+			{"testing.tRunner", "/usr/local/go/src/testing/testing.go", 1689},
+		}},
+		{race.Goroutines[1], "Goroutine 7 (finished) created at", []StackFrame{
+			{"example.com/m.TestInc", "/src/m/counter_test.go", 14},
+		}},
+	}
+	if len(race.Accesses) != 2 || len(race.Goroutines) != 2 {
+		t.Fatalf("race has %d accesses and %d goroutines, want 2 and 2", len(race.Accesses), len(race.Goroutines))
+	}
+	for _, tt := range tests {
+		if tt.stack.Header != tt.header || fmt.Sprint(tt.stack.Frames) != fmt.Sprint(tt.frames) {
+			t.Errorf("stack = %q %v, want %q %v", tt.stack.Header, tt.stack.Frames, tt.header, tt.frames)
+		}
+	}
+}
+
+func TestDataRacesDeduplicatedAndLinked(t *testing.T) {
+	// The same race in three runs of -count=3, each time with other addresses and goroutines
+	var b strings.Builder
+	for run := 0; run < 3; run++ {
+		fmt.Fprintf(&b, `{"Action":"run","Package":"example.com/m","Test":"TestInc"}`+"\n")
+		report := strings.ReplaceAll(raceReport, "goroutine 8", fmt.Sprintf("goroutine %d", 8+run*2))
+		report = strings.ReplaceAll(report, "0x00c0000a0018", fmt.Sprintf("0x00c0000a%04x", run*8))
+		for _, line := range strings.SplitAfter(report, "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, `{"Action":"output","Package":"example.com/m","Test":"TestInc","Output":%q}`+"\n", line)
+			}
+		}
+		fmt.Fprintf(&b, `{"Action":"fail","Package":"example.com/m","Test":"TestInc","Elapsed":0.1}`+"\n")
+	}
+	_, races := parseTestEvents(strings.NewReader(b.String()))
+	if len(races) != 1 || races[0].Count != 3 {
+		t.Fatalf("parseTestEvents found %d races, want one reported 3 times: %+v", len(races), races)
+	}
+
+	summaries := []CodeSummary{{
+		Filename: "/src/m/counter.go",
+		Functions: []FuncDecl{
+			{Name: "(*Counter).Inc", Position: Position{File: "/src/m/counter.go", Line: 10, EndLine: 13}},
+			{Name: "helper", Position: Position{File: "/src/m/counter.go", Line: 18, EndLine: 22}},
+			{Name: "unrelated", Position: Position{File: "/src/m/counter.go", Line: 24, EndLine: 30}},
+		},
+	}}
+	linkDataRaces(summaries, races)
+	var names []string
+	for _, f := range races[0].Functions {
+		names = append(names, f.Name)
+	}
+	if want := []string{"(*Counter).Inc", "helper"}; fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("race functions = %v, want %v", names, want)
+	}
+	if len(summaries[0].Problems) != 0 {
+		t.Errorf("races were added to the refactoring problems: %+v", summaries[0].Problems)
+	}
+	if got, want := races[0].Summary(), "a data race in TestInc, reported 3 times"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package cyclomatic
+
+// empty has no decision points.
+func empty() {}
+
+// declared has no body.
+func declared() int
+
+// single has one if.
+func single(x int) int {
+	if x > 0 {
+		return 1
+	}
+	return 0
+}
+
+// elseChain has an if with two else-ifs and an else.
+func elseChain(x int) string {
+	if x < 0 {
+		return "negative"
+	} else if x == 0 {
+		return "zero"
+	} else if x < 10 {
+		return "small"
+	} else {
+		return "large"
+	}
+}
+
+// loops has a three-clause for, a condition-only for, an infinite for and a range.
+func loops(xs []int) int {
+	total := 0
+	for i := 0; i < len(xs); i++ {
+		total += xs[i]
+	}
+	for total > 100 {
+		total /= 2
+	}
+	for {
+		break
+	}
+	for _, x := range xs {
+		total -= x
+	}
+	return total
+}
+
+// booleans mixes && and || inside and outside conditions.
+func booleans(a, b, c, d bool) bool {
+	ok := a && b || c
+	if ok && (c || d) {
+		return true
+	}
+	return !a || !b && d
+}
@@ -0,0 +1,33 @@
+package cyclomatic
+
+import "sort"
+
+// withClosure counts the decision points of its function literal too.
+func withClosure(xs []int, desc bool) {
+	sort.Slice(xs, func(i, j int) bool {
+		if desc {
+			return xs[i] > xs[j]
+		}
+		return xs[i] < xs[j]
+	})
+	for range xs {
+	}
+}
+
+// nested has deeply nested control flow.
+func nested(grid [][]int) int {
+	count := 0
+	for _, row := range grid {
+		for _, cell := range row {
+			if cell > 0 {
+				switch {
+				case cell%2 == 0:
+					count++
+				case cell%3 == 0 || cell%5 == 0:
+					count += 2
+				}
+			}
+		}
+	}
+	return count
+}
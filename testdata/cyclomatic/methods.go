@@ -0,0 +1,39 @@
+package cyclomatic
+
+// Stack is a generic stack.
+type Stack[T any] struct {
+	items []T
+}
+
+// Pop removes the top element.
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	if len(s.items) == 0 {
+		return zero, false
+	}
+	top := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return top, true
+}
+
+// Pair is a generic pair.
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// Equal compares two pairs.
+func (p Pair[K, V]) Equal(o Pair[K, V], eq func(a, b V) bool) bool {
+	return p.Key == o.Key && eq(p.Value, o.Value)
+}
+
+// counter has a value receiver.
+type counter int
+
+// inc increments unless the limit is hit.
+func (c counter) inc(limit int) counter {
+	if int(c) >= limit || limit < 0 {
+		return c
+	}
+	return c + 1
+}
@@ -0,0 +1,102 @@
+package cyclomatic
+
+import "fmt"
+
+// twenty is the 20-case switch that used to score 2.
+func twenty(n int) string {
+	switch n {
+	case 0:
+		return "a"
+	case 1:
+		return "b"
+	case 2:
+		return "c"
+	case 3:
+		return "d"
+	case 4:
+		return "e"
+	case 5:
+		return "f"
+	case 6:
+		return "g"
+	case 7:
+		return "h"
+	case 8:
+		return "i"
+	case 9:
+		return "j"
+	case 10:
+		return "k"
+	case 11:
+		return "l"
+	case 12:
+		return "m"
+	case 13:
+		return "n"
+	case 14:
+		return "o"
+	case 15:
+		return "p"
+	case 16:
+		return "q"
+	case 17:
+		return "r"
+	case 18:
+		return "s"
+	case 19:
+		return "t"
+	default:
+		return "?"
+	}
+}
+
+// multiValue has cases listing several values and a default; each clause counts once.
+func multiValue(r rune) bool {
+	switch r {
+	case 'a', 'e', 'i', 'o', 'u':
+		return true
+	case 'y':
+		return false
+	default:
+		return false
+	}
+}
+
+// tagless is a switch without a tag whose case uses &&.
+func tagless(x, y int) int {
+	switch {
+	case x > 0 && y > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// typeSwitch counts its non-default type cases.
+func typeSwitch(v interface{}) string {
+	switch t := v.(type) {
+	case int, int64:
+		return fmt.Sprint(t)
+	case string:
+		return t
+	case nil:
+		return "nil"
+	default:
+		return "?"
+	}
+}
+
+// selects counts non-default comm clauses.
+func selects(a, b chan int, done chan struct{}) int {
+	for {
+		select {
+		case x := <-a:
+			return x
+		case b <- 1:
+		case <-done:
+			return 0
+		default:
+		}
+	}
+}